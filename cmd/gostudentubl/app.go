@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/time/rate"
+
+	"github.com/emandor/gostudentubl/internal/audit"
+	"github.com/emandor/gostudentubl/internal/breaker"
+	"github.com/emandor/gostudentubl/internal/config"
+	"github.com/emandor/gostudentubl/internal/fingerprint"
+	"github.com/emandor/gostudentubl/internal/history"
+	"github.com/emandor/gostudentubl/internal/httpx"
+	"github.com/emandor/gostudentubl/internal/moodle"
+	"github.com/emandor/gostudentubl/internal/notify"
+	"github.com/emandor/gostudentubl/internal/runner"
+	"github.com/emandor/gostudentubl/internal/telemetry"
+)
+
+// app holds everything the subcommands share.
+type app struct {
+	cfg      config.Config
+	log      zerolog.Logger
+	loc      *time.Location
+	m        *moodle.Client
+	notifier *notify.Notifier
+	history  *history.Store
+	runner   *runner.Runner
+}
+
+// atExit is flushed by main after the command returns.
+var atExit []func(context.Context) error
+
+// newApp loads the config and wires everything up. cli sends console logs
+// to stderr instead of stdout.
+func newApp(cli bool) (*app, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+
+	newLogger := telemetry.NewLogger
+	if cli {
+		newLogger = telemetry.NewCLILogger
+	}
+	log, err := newLogger(telemetry.LogOptions{
+		Level:      cfg.LogLevel,
+		Format:     cfg.LogFormat,
+		File:       cfg.LogFile,
+		MaxSizeMB:  cfg.LogMaxSizeMB,
+		MaxBackups: cfg.LogMaxBackups,
+		MaxAgeDays: cfg.LogMaxAgeDays,
+		Compress:   cfg.LogCompress,
+		Console:    cfg.LogStdout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("log: %w", err)
+	}
+
+	traceOut := os.Stdout
+	if cli {
+		traceOut = os.Stderr
+	}
+	shutdown, err := telemetry.SetupTracing(context.Background(), telemetry.TraceOptions{
+		Exporter: cfg.TraceExporter,
+		Endpoint: cfg.TraceEndpoint,
+		Insecure: cfg.TraceInsecure,
+		Service:  "gostudentubl",
+		Out:      traceOut,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %w", err)
+	}
+	atExit = append(atExit, shutdown)
+
+	limits := &httpx.Limits{
+		Global:    rate.NewLimiter(rate.Limit(cfg.RatePerSec), cfg.RateBurst),
+		Endpoints: map[string]*rate.Limiter{},
+		Log:       log,
+	}
+	for name, perSec := range cfg.RateEndpoints {
+		limits.Endpoints[name] = rate.NewLimiter(rate.Limit(perSec), 1)
+	}
+	hc, err := httpx.NewHTTP(cfg.RequestTimeout(), limits)
+	if err != nil {
+		return nil, fmt.Errorf("http: %w", err)
+	}
+
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("timezone: %w", err)
+	}
+
+	endpoints, err := cfg.Endpoints()
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	profile, err := cfg.Profile()
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	log.Debug().Str("profile", profile.Name).Int("version", profile.Version).Msg("moodle profile")
+	m := &moodle.Client{
+		HC:           hc,
+		Jar:          httpx.Jar(hc),
+		Log:          log,
+		UA:           "Mozilla/5.0",
+		Loc:          loc,
+		Base:         endpoints,
+		Profile:      &profile,
+		Identity:     cfg.FullName,
+		Snapshots:    cfg.Snapshots(),
+		Fingerprints: &fingerprint.Store{Path: filepath.Join(cfg.StateDir, "fingerprints.json")},
+	}
+
+	vault, err := config.OpenVault()
+	if err != nil {
+		return nil, err
+	}
+
+	notifier, err := newNotifier(cfg, log)
+	if err != nil {
+		return nil, fmt.Errorf("notify: %w", err)
+	}
+
+	hist, err := history.Open(cfg.StateDir)
+	if err != nil {
+		return nil, fmt.Errorf("history: %w", err)
+	}
+
+	r := &runner.Runner{
+		Log:            log,
+		CurrentPeriode: cfg.CurrentPeriode,
+		M:              m,
+		Dry:            cfg.DryRun,
+		Conc:           cfg.Concurrency,
+		MaxRequests:    cfg.RunMaxRequests,
+		Notify:         notifier,
+		History:        hist,
+		DigestPeriod:   cfg.DigestPeriod,
+		Alerts:         &notify.Alerter{N: notifier, Path: filepath.Join(cfg.StateDir, "alerts.json")},
+		Vault:          vault,
+		Audit:          &audit.Log{Dir: filepath.Join(cfg.StateDir, "audit")},
+		LoginLockPath:  filepath.Join(cfg.StateDir, "login_lock.json"),
+		RunLockPath:    filepath.Join(cfg.StateDir, "run"),
+	}
+	// a GET that finds the session expired logs in again and is replayed
+	m.Reauth = r.Login
+	if cfg.BreakerThreshold > 0 {
+		r.Breaker = &breaker.Breaker{
+			Path:      filepath.Join(cfg.StateDir, "breaker.json"),
+			Threshold: cfg.BreakerThreshold,
+			ProbeMin:  time.Duration(cfg.BreakerProbeMinSec) * time.Second,
+			ProbeMax:  time.Duration(cfg.BreakerProbeMaxSec) * time.Second,
+		}
+	}
+
+	return &app{cfg: cfg, log: log, loc: loc, m: m, notifier: notifier, history: hist, runner: r}, nil
+}
+
+func newNotifier(cfg config.Config, log zerolog.Logger) (*notify.Notifier, error) {
+	hub, err := newNotifyHub(cfg)
+	if err != nil {
+		return nil, err
+	}
+	hub.Log = log
+
+	messages, err := notify.NewRenderer(cfg.NotifyLocale, cfg.Timezone, cfg.NotifyTemplateDir)
+	if err != nil {
+		return nil, fmt.Errorf("templates: %w", err)
+	}
+
+	routes := notify.DefaultRoutes(cfg.WAMe, cfg.WaGroup, hub.RichBackends())
+	if cfg.NotifyRoutesFile != "" {
+		if routes, err = notify.LoadRoutes(cfg.NotifyRoutesFile); err != nil {
+			return nil, fmt.Errorf("routes: %w", err)
+		}
+	}
+	router, err := notify.NewRouter(routes, messages.Location(), hub)
+	if err != nil {
+		return nil, fmt.Errorf("routes: %w", err)
+	}
+
+	return &notify.Notifier{Hub: hub, Router: router, Messages: messages}, nil
+}
+
+func newNotifyHub(cfg config.Config) (*notify.Hub, error) {
+	hc := &http.Client{Timeout: cfg.RequestTimeout()}
+	hub := notify.NewHub()
+	wa := &notify.WhatsApp{
+		Provider: cfg.WAProvider,
+		Endpoint: cfg.WAEndpoint,
+		Token:    cfg.WAToken,
+		Session:  cfg.WASession,
+		From:     cfg.WAFrom,
+		Account:  cfg.WAAccountSID,
+		HC:       hc,
+	}
+	if err := wa.Validate(); err != nil {
+		return nil, err
+	}
+	hub.Register(notify.BackendWhatsApp, wa)
+	if cfg.DiscordWebhookURL != "" {
+		hub.Register(notify.BackendDiscord, &notify.Discord{URL: cfg.DiscordWebhookURL, HC: hc})
+	}
+	if cfg.TelegramBotToken != "" {
+		hub.Register(notify.BackendTelegram, &notify.Telegram{Token: cfg.TelegramBotToken, HC: hc})
+	}
+	if cfg.SlackWebhookURL != "" {
+		hub.Register(notify.BackendSlack, &notify.Slack{URL: cfg.SlackWebhookURL, HC: hc})
+	}
+	if cfg.WebhookURL != "" {
+		wh := &notify.Webhook{URL: cfg.WebhookURL, Headers: cfg.WebhookHeaders, HC: hc}
+		if cfg.WebhookTemplateFile != "" {
+			tmpl, err := notify.ParseWebhookTemplate(cfg.WebhookTemplateFile)
+			if err != nil {
+				return nil, fmt.Errorf("webhook template: %w", err)
+			}
+			wh.Body = tmpl
+		}
+		hub.Register(notify.BackendWebhook, wh)
+	}
+	return hub, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/emandor/gostudentubl/internal/audit"
+	"github.com/emandor/gostudentubl/internal/config"
+)
+
+func cmdAudit(args []string) int {
+	if len(args) == 0 || args[0] != "verify" {
+		fmt.Fprintln(os.Stderr, "usage: gostudentubl audit verify [flags]")
+		return exitUsage
+	}
+	fs := newFlagSet("audit verify", "", "check the hash chain and stored confirmation pages of the audit log.\nexit code 1 when anything was tampered with")
+	out := outputFlag(fs)
+	dir := fs.String("dir", "", "audit directory (default <STATE_DIR>/audit)")
+	if fs.Parse(args[1:]) != nil || out.valid() != nil {
+		return exitUsage
+	}
+	if *dir == "" {
+		// verifying should not depend on a complete config
+		stateDir := "state"
+		if cfg, err := config.Load(); err == nil {
+			stateDir = cfg.StateDir
+		}
+		*dir = filepath.Join(stateDir, "audit")
+	}
+
+	rep, err := (&audit.Log{Dir: *dir}).Verify()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	rows := [][]string{{"entries", strconv.Itoa(rep.Entries)}, {"head", rep.Head}}
+	status := "intact"
+	if !rep.OK() {
+		status = "BROKEN"
+	}
+	rows = append(rows, []string{"status", status})
+	for _, p := range rep.Problems {
+		rows = append(rows, []string{"problem", p})
+	}
+	if err := out.print(rep, []string{"FIELD", "VALUE"}, rows); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if !rep.OK() {
+		return exitFailed
+	}
+	return exitOK
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/emandor/gostudentubl/internal/notify"
+)
+
+type checkResult struct {
+	Check  string `json:"check"`
+	Status string `json:"status"` // ok, fail or skip
+	Detail string `json:"detail,omitempty"`
+}
+
+type checks []checkResult
+
+func (c *checks) add(name string, err error, okDetail string) bool {
+	if err != nil {
+		*c = append(*c, checkResult{Check: name, Status: "fail", Detail: err.Error()})
+		return false
+	}
+	*c = append(*c, checkResult{Check: name, Status: "ok", Detail: okDetail})
+	return true
+}
+
+func (c *checks) skip(name, why string) {
+	*c = append(*c, checkResult{Check: name, Status: "skip", Detail: why})
+}
+
+func (c checks) failed() bool {
+	for _, r := range c {
+		if r.Status == "fail" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c checks) print(out *output) int {
+	rows := make([][]string, 0, len(c))
+	for _, r := range c {
+		rows = append(rows, []string{r.Check, r.Status, r.Detail})
+	}
+	if err := out.print(c, []string{"CHECK", "STATUS", "DETAIL"}, rows); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if c.failed() {
+		return exitFailed
+	}
+	return exitOK
+}
+
+func cmdLoginCheck(args []string) int {
+	fs := newFlagSet("login-check", "", "log in with the configured credentials and verify the session")
+	out := outputFlag(fs)
+	unlock := fs.Bool("unlock", false, "allow logins again after Moodle rejected the credentials")
+	if fs.Parse(args) != nil || out.valid() != nil {
+		return exitUsage
+	}
+
+	var res checks
+	a, err := newApp(true)
+	if !res.add("config", err, "") {
+		return res.print(out)
+	}
+	if *unlock {
+		lock, locked := a.runner.LoginLock()
+		if locked {
+			res.add("unlock", a.runner.UnlockLogin(), "was disabled after "+lock.Cause)
+		} else {
+			res.skip("unlock", "logins were not disabled")
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	res.add("login", a.runner.Login(ctx), a.m.Base.LoginURL)
+	return res.print(out)
+}
+
+func cmdDoctor(args []string) int {
+	fs := newFlagSet("doctor", "", "check config, connectivity, login, parsers and notifier reachability")
+	out := outputFlag(fs)
+	if fs.Parse(args) != nil || out.valid() != nil {
+		return exitUsage
+	}
+
+	var res checks
+	a, err := newApp(true)
+	if !res.add("config", err, "") {
+		return res.print(out)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+
+	// connectivity: any HTTP answer from the login page will do
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.m.Base.LoginURL, nil)
+	if err == nil {
+		var resp *http.Response
+		if resp, err = a.m.HC.Do(req); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 500 {
+				err = fmt.Errorf("login page answered %s", resp.Status)
+			}
+		}
+	}
+	if !res.add("connectivity", err, a.m.Base.LoginURL) {
+		res.skip("login", "no connectivity")
+		res.skip("parsers", "no connectivity")
+	} else if !res.add("login", a.runner.Login(ctx), "") {
+		res.skip("parsers", "login failed")
+	} else {
+		doctorParsers(ctx, a, &res)
+	}
+
+	doctorNotifiers(ctx, a.notifier.Hub, &res)
+	return res.print(out)
+}
+
+// doctorParsers walks courses -> attendance list -> view page on the first usable course.
+func doctorParsers(ctx context.Context, a *app, res *checks) {
+	courses, err := a.m.GetCourses(ctx)
+	if err == nil && len(courses) == 0 {
+		err = fmt.Errorf("no course parsed from the overview page")
+	}
+	if !res.add("parse courses", err, fmt.Sprintf("%d courses", len(courses))) {
+		return
+	}
+
+	for _, c := range courses {
+		if a.cfg.CurrentPeriode != "" && c.Periode != a.cfg.CurrentPeriode {
+			continue
+		}
+		ats, err := a.m.GetAttendance(ctx, c)
+		if !res.add("parse attendance list", err, fmt.Sprintf("%s: %d attendances", c.CourseName, len(ats))) {
+			return
+		}
+		if len(ats) == 0 {
+			continue
+		}
+		vi, err := a.m.ViewAttendanceByID(ctx, ats[0].AttendanceID)
+		switch {
+		case err == nil:
+			res.add("parse attendance view", nil, "open session found")
+		case len(vi.Sessions) > 0:
+			res.add("parse attendance view", nil, fmt.Sprintf("%d sessions, none open", len(vi.Sessions)))
+		default:
+			res.add("parse attendance view", fmt.Errorf("no submit link and no session log: %w", err), "")
+		}
+		return
+	}
+	res.skip("parse attendance list", "no course with attendance in CURRENT_PERIODE")
+}
+
+func doctorNotifiers(ctx context.Context, hub *notify.Hub, res *checks) {
+	names := make([]string, 0, len(hub.Senders))
+	for n := range hub.Senders {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		p, ok := hub.Senders[n].(notify.Pinger)
+		if !ok {
+			res.skip("notify "+n, "cannot be checked without sending")
+			continue
+		}
+		res.add("notify "+n, p.Ping(ctx), "reachable")
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/emandor/gostudentubl/internal/config"
+)
+
+func cmdConfig(args []string) int {
+	if len(args) == 0 || args[0] != "explain" {
+		fmt.Fprintln(os.Stderr, "usage: gostudentubl config explain [flags]")
+		return exitUsage
+	}
+	fs := newFlagSet("config explain", "", "print the effective config and where each value came from (secrets masked)")
+	out := outputFlag(fs)
+	if fs.Parse(args[1:]) != nil || out.valid() != nil {
+		return exitUsage
+	}
+
+	settings, err := config.Explain()
+	if settings != nil {
+		rows := make([][]string, 0, len(settings))
+		for _, s := range settings {
+			rows = append(rows, []string{s.Key, s.Value, s.Source})
+		}
+		if perr := out.print(settings, []string{"KEY", "VALUE", "SOURCE"}, rows); perr != nil {
+			fmt.Fprintln(os.Stderr, perr)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\ninvalid config:\n%v\n", err)
+		return exitFailed
+	}
+	return exitOK
+}
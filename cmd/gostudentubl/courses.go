@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/emandor/gostudentubl/internal/moodle"
+)
+
+type courseOut struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Periode string `json:"periode"`
+	Group   string `json:"group"`
+	Grade   *int   `json:"grade,omitempty"`
+	Link    string `json:"link"`
+}
+
+func cmdCourses(args []string) int {
+	fs := newFlagSet("courses", "", "list the courses parsed from the grade overview")
+	out := outputFlag(fs)
+	all := fs.Bool("all", false, "include courses outside CURRENT_PERIODE")
+	if fs.Parse(args) != nil || out.valid() != nil {
+		return exitUsage
+	}
+
+	a, err := newApp(true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	var cs []moodle.Course
+	if *all {
+		cs, err = allCourses(ctx, a)
+	} else {
+		cs, err = a.runner.Courses(ctx)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+
+	list := make([]courseOut, 0, len(cs))
+	var rows [][]string
+	for _, c := range cs {
+		list = append(list, courseOut{ID: c.CourseID, Name: c.CourseName, Periode: c.Periode, Group: c.Group, Grade: c.Grade, Link: c.CourseLink})
+		grade := "-"
+		if c.Grade != nil {
+			grade = strconv.Itoa(*c.Grade)
+		}
+		rows = append(rows, []string{strconv.Itoa(c.CourseID), c.CourseName, c.Periode, c.Group, grade})
+	}
+	if err := out.print(list, []string{"ID", "NAME", "PERIODE", "GROUP", "GRADE"}, rows); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+type sessionOut struct {
+	Date        string     `json:"date"`
+	At          *time.Time `json:"at,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Status      string     `json:"status,omitempty"`
+	Earned      float64    `json:"earned"`
+	Max         float64    `json:"max"`
+	Taken       bool       `json:"taken"`
+}
+
+type attendanceOut struct {
+	ID         string       `json:"id"`
+	Title      string       `json:"title"`
+	Name       string       `json:"name"`
+	Link       string       `json:"link"`
+	Open       bool         `json:"open"`
+	SubmitLink string       `json:"submitLink,omitempty"`
+	Sessions   []sessionOut `json:"sessions"`
+	Error      string       `json:"error,omitempty"`
+}
+
+func cmdAttendance(args []string) int {
+	fs := newFlagSet("attendance", "<courseID>", "list a course's attendance activities and whether a session is open")
+	out := outputFlag(fs)
+	if fs.Parse(args) != nil || out.valid() != nil || fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	courseID, err := strconv.Atoi(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bad course ID %q\n", fs.Arg(0))
+		return exitUsage
+	}
+
+	a, err := newApp(true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	cs, err := allCourses(ctx, a)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	var course *moodle.Course
+	for i := range cs {
+		if cs[i].CourseID == courseID {
+			course = &cs[i]
+		}
+	}
+	if course == nil {
+		fmt.Fprintf(os.Stderr, "course %d not found, see `gostudentubl courses -all`\n", courseID)
+		return exitFailed
+	}
+
+	ats, err := a.m.GetAttendance(ctx, *course)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+
+	list := make([]attendanceOut, 0, len(ats))
+	var rows [][]string
+	for _, at := range ats {
+		o := attendanceOut{ID: at.AttendanceID, Title: at.Title, Name: at.AttendanceName, Link: at.AttendanceLink, Sessions: []sessionOut{}}
+		vi, err := a.m.ViewAttendanceByID(ctx, at.AttendanceID)
+		if err == nil {
+			o.Open, o.SubmitLink = true, vi.SubmitLink
+		} else if len(vi.Sessions) == 0 {
+			o.Error = err.Error()
+		}
+		next := "-"
+		for _, s := range vi.Sessions {
+			so := sessionOut{Date: s.Date, Description: s.Description, Status: s.Status, Earned: s.Earned, Max: s.Max, Taken: s.Taken}
+			if !s.At.IsZero() {
+				t := s.At
+				so.At = &t
+			}
+			if !s.Taken && next == "-" {
+				next = s.Date
+			}
+			o.Sessions = append(o.Sessions, so)
+		}
+		list = append(list, o)
+		rows = append(rows, []string{o.ID, o.Name, yesNo(o.Open), strconv.Itoa(len(o.Sessions)), next})
+	}
+	if err := out.print(list, []string{"ID", "NAME", "OPEN", "SESSIONS", "NEXT"}, rows); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+func allCourses(ctx context.Context, a *app) ([]moodle.Course, error) {
+	if err := a.runner.Login(ctx); err != nil {
+		return nil, err
+	}
+	cs, err := a.m.GetCourses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].CourseName < cs[j].CourseName })
+	return cs, nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
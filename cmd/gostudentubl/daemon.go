@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/emandor/gostudentubl/internal/admin"
+	"github.com/emandor/gostudentubl/internal/chatops"
+	"github.com/emandor/gostudentubl/internal/schedule"
+)
+
+func cmdDaemon(args []string) int {
+	fs := newFlagSet("daemon", "", "run the cron scheduler until SIGINT/SIGTERM")
+	if fs.Parse(args) != nil {
+		return exitUsage
+	}
+
+	a, err := newApp(false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "setup:", err)
+		return exitFailed
+	}
+	cfg, r, log := a.cfg, a.runner, a.log
+
+	// cancelled on shutdown; everything the daemon starts derives from it
+	base, stop := context.WithCancel(context.Background())
+	jobs := schedule.New(cfg.Timezone, log)
+	jobs.Ctx = base
+
+	errWeekDay := jobs.Add(cfg.CronWeekday, r)
+	if errWeekDay != nil {
+		log.Fatal().Err(errWeekDay).Msg("adding weekday job")
+	}
+
+	errWeekEnd := jobs.Add(cfg.CronWeekend, r)
+	if errWeekEnd != nil {
+		log.Fatal().Err(errWeekEnd).Msg("adding weekend job")
+	}
+
+	if cfg.DigestCron != "" {
+		if err := jobs.AddFunc(cfg.DigestCron, "digest", r.RunDigest); err != nil {
+			log.Fatal().Err(err).Msg("adding digest job")
+		}
+	}
+
+	jobs.Start()
+	log.Info().Str("tz", cfg.Timezone).Msg("🤖 live! beep beep...")
+
+	go r.WatchBreaker(base)
+
+	var servers []*http.Server
+	if cfg.ChatOpsAddr != "" {
+		ops := &chatops.Server{
+			Log:    log,
+			Secret: cfg.ChatOpsSecret,
+			Allow:  cfg.ChatOpsAllow,
+			Runner: r,
+			Jobs:   jobs,
+			Hub:    a.notifier.Hub,
+			Loc:    a.loc,
+			Ctx:    base,
+		}
+		servers = append(servers, serve(base, log, "chatops", cfg.ChatOpsAddr, ops.Handler()))
+	}
+	if cfg.AdminAddr != "" {
+		adm := &admin.Server{Log: log, Token: cfg.AdminToken, Runner: r, Jobs: jobs, Ctx: base}
+		servers = append(servers, serve(base, log, "admin", cfg.AdminAddr, adm.Handler()))
+		// readiness needs a login; do one now instead of waiting for the first job
+		go func() {
+			ctx, cancel := context.WithTimeout(base, 2*time.Minute)
+			defer cancel()
+			if err := r.WarmUp(ctx); err != nil {
+				log.Warn().Err(err).Msg("startup login")
+			}
+		}()
+	}
+
+	// graceful shutdown on SIGINT/SIGTERM
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	for _, srv := range servers {
+		_ = srv.Shutdown(ctx)
+	}
+	cancel()
+	stop()
+	jobs.Stop()
+	// every run, scheduled or started over chat or the admin API, is
+	// cancelled by now; let it write its history and audit entries
+	// before exiting
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	if err := r.Idle(ctx); err != nil {
+		log.Warn().Err(err).Msg("run still active at shutdown")
+	}
+	cancel()
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	_ = a.notifier.Hub.Wait(ctx)
+	cancel()
+	log.Info().Msg("shutdown")
+	return exitOK
+}
+
+// serve starts an HTTP listener in the background; Shutdown stops it.
+// Request contexts derive from base.
+func serve(base context.Context, log zerolog.Logger, name, addr string, h http.Handler) *http.Server {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return base },
+	}
+	go func() {
+		log.Info().Str("addr", addr).Msgf("%s listening", name)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg(name)
+		}
+	}()
+	return srv
+}
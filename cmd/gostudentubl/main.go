@@ -2,76 +2,89 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
-
-	"golang.org/x/time/rate"
-
-	"github.com/emandor/gostudentubl/internal/config"
-	"github.com/emandor/gostudentubl/internal/httpx"
-	"github.com/emandor/gostudentubl/internal/moodle"
-	"github.com/emandor/gostudentubl/internal/runner"
-	"github.com/emandor/gostudentubl/internal/schedule"
-	"github.com/emandor/gostudentubl/internal/telemetry"
+	"sort"
+	"strings"
+	"time"
 )
 
-func main() {
-	log := telemetry.NewLogger()
-	cfg, err := config.Load()
-	if err != nil {
-		log.Fatal().Err(err).Msg("config")
-	}
+// Exit codes shared by every subcommand.
+const (
+	exitOK      = 0
+	exitFailed  = 1 // the command could not do its job (login, config, network...)
+	exitUsage   = 2
+	exitPartial = 3 // run finished but some sessions failed
+	exitBusy    = 4 // another run holds the lock, e.g. the daemon's
+)
 
-	hc, err := httpx.NewHTTP(cfg.RequestTimeout())
-	if err != nil {
-		log.Fatal().Err(err).Msg("http")
-	}
+type command struct {
+	summary string
+	run     func(args []string) int
+}
 
-	m := &moodle.Client{HC: hc, UA: "Mozilla/5.0"}
-	m.Base.LoginURL = cfg.LoginURL
-	m.Base.CoursesURL = cfg.CoursesURL
-	m.Base.AttendanceListURL = cfg.AttendanceListURL
-	m.Base.AttendanceURL = cfg.AttendanceURL
-	m.Base.AttendanceFormURL = cfg.AttendanceFormURL
+var commands map[string]command
 
-	r := &runner.Runner{
-		Log:            log,
-		CurrentPeriode: cfg.CurrentPeriode,
-		M:              m,
-		Dry:            cfg.DryRun,
-		Conc:           cfg.Concurrency,
-		Limiter:        rate.NewLimiter(rate.Limit(cfg.RatePerSec), cfg.RateBurst),
+func init() {
+	commands = map[string]command{
+		"daemon":      {"run the cron scheduler (default)", cmdDaemon},
+		"run":         {"one attendance run, then exit", cmdRun},
+		"courses":     {"list parsed courses", cmdCourses},
+		"attendance":  {"list attendances and open sessions of a course", cmdAttendance},
+		"login-check": {"log in and verify the session", cmdLoginCheck},
+		"notify":      {"notification tools (notify test)", cmdNotify},
+		"audit":       {"audit log tools (audit verify)", cmdAudit},
+		"config":      {"config tools (config explain)", cmdConfig},
+		"snapshot":    {"saved pages the parsers failed on (snapshot list|open)", cmdSnapshot},
+		"secret":      {"vault tools (secret set|list|rotate)", cmdSecret},
+		"doctor":      {"check config, connectivity, login, parsers and notifiers", cmdDoctor},
 	}
+}
 
-	jobs := schedule.New(cfg.Timezone, log)
-
-	errWeekDay := jobs.Add(cfg.CronWeekday, r)
-	if errWeekDay != nil {
-		log.Fatal().Err(errWeekDay).Msg("adding weekday job")
+func main() {
+	args := os.Args[1:]
+	name := "daemon"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
-
-	errWeekEnd := jobs.Add(cfg.CronWeekend, r)
-	if errWeekEnd != nil {
-		log.Fatal().Err(errWeekEnd).Msg("adding weekend job")
+	if name == "help" {
+		usage()
+		return
 	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage()
+		os.Exit(exitUsage)
+	}
+	code := cmd.run(args)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	for _, fn := range atExit {
+		_ = fn(ctx)
+	}
+	cancel()
+	os.Exit(code)
+}
 
-	jobs.Start()
-	log.Info().Str("tz", cfg.Timezone).Msg("🤖 live! beep beep...")
-
-	// also allow single run via SIGUSR1
-	go func() {
-		ch := make(chan os.Signal, 1)
-		signal.Notify(ch, syscall.SIGUSR1)
-		for range ch {
-			_ = r.RunAttendance(context.Background())
-		}
-	}()
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: gostudentubl <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	names := make([]string, 0, len(commands))
+	for n := range commands {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", n, commands[n].summary)
+	}
+}
 
-	// graceful shutdown on SIGINT/SIGTERM
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
-	<-quit
-	jobs.Stop()
-	log.Info().Msg("shutdown")
+func newFlagSet(name, argsUsage, summary string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gostudentubl %s [flags] %s\n\n%s\n\n", name, argsUsage, summary)
+		fs.PrintDefaults()
+	}
+	return fs
 }
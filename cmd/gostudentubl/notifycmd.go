@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/emandor/gostudentubl/internal/notify"
+)
+
+type deliveryOut struct {
+	Backend  string `json:"backend"`
+	To       string `json:"to"`
+	Audience string `json:"audience"`
+	OK       bool   `json:"ok"`
+	ID       string `json:"id,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func cmdNotify(args []string) int {
+	if len(args) == 0 || args[0] != "test" {
+		fmt.Fprintln(os.Stderr, "usage: gostudentubl notify test [flags]")
+		return exitUsage
+	}
+	fs := newFlagSet("notify test", "", "send a sample event through the routing table and report every delivery")
+	out := outputFlag(fs)
+	event := fs.String("event", string(notify.EventSubmitted), "event type to simulate")
+	course := fs.String("course", "Test Course", "course name on the sample event, for course routes")
+	if fs.Parse(args[1:]) != nil || out.valid() != nil {
+		return exitUsage
+	}
+
+	a, err := newApp(true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	n := a.notifier
+	ev := notify.Event{
+		Type:       notify.EventType(*event),
+		Course:     *course,
+		Attendance: "Test Attendance",
+		Link:       a.m.Base.CoursesURL,
+		Detail:     "this is a test message from `gostudentubl notify test`",
+		At:         time.Now().In(a.loc),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	var list []deliveryOut
+	var rows [][]string
+	failed := false
+	for _, rc := range n.Router.Resolve(ev, time.Now()) {
+		d := deliveryOut{Backend: rc.Backend, To: rc.To, Audience: string(rc.Audience)}
+		text, err := n.Messages.Render(rc.Audience, ev)
+		if err == nil {
+			d.ID, err = n.Hub.Send(ctx, notify.Delivery{Backend: rc.Backend, To: rc.To, Message: notify.Message{Text: text, Event: ev}})
+		}
+		d.OK = err == nil
+		if err != nil {
+			d.Error, failed = err.Error(), true
+		}
+		list = append(list, d)
+		rows = append(rows, []string{d.Backend, d.To, d.Audience, yesNo(d.OK), d.ID, d.Error})
+	}
+	if len(list) == 0 {
+		fmt.Fprintf(os.Stderr, "no route matches a %q event\n", *event)
+		return exitFailed
+	}
+	if err := out.print(list, []string{"BACKEND", "TO", "AUDIENCE", "OK", "ID", "ERROR"}, rows); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if failed {
+		return exitFailed
+	}
+	return exitOK
+}
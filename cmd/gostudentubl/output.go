@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// output prints either a table or the JSON form of the same data.
+type output struct {
+	format string
+	w      io.Writer
+}
+
+func outputFlag(fs *flag.FlagSet) *output {
+	o := &output{format: "table", w: os.Stdout}
+	fs.StringVar(&o.format, "o", "table", "output format: table or json")
+	fs.StringVar(&o.format, "output", "table", "output format: table or json")
+	return o
+}
+
+func (o *output) valid() error {
+	if o.format != "table" && o.format != "json" {
+		return fmt.Errorf("unknown output format %q", o.format)
+	}
+	return nil
+}
+
+// print writes v as JSON, or header and rows as an aligned table.
+func (o *output) print(v any, header []string, rows [][]string) error {
+	if o.format == "json" {
+		enc := json.NewEncoder(o.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(o.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, r := range rows {
+		fmt.Fprintln(tw, strings.Join(r, "\t"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/emandor/gostudentubl/internal/runner"
+)
+
+func cmdRun(args []string) int {
+	fs := newFlagSet("run", "", "log in, submit every open session once and exit.\nexit codes: 0 ok, 1 failed, 3 some sessions failed, 4 another run is active")
+	out := outputFlag(fs)
+	dry := fs.Bool("dry-run", false, "find open sessions but do not submit")
+	timeout := fs.Duration("timeout", 10*time.Minute, "give up after this long")
+	if fs.Parse(args) != nil || out.valid() != nil {
+		return exitUsage
+	}
+
+	a, err := newApp(true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	if *dry {
+		a.runner.Dry = true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	res, err := a.runner.Run(ctx)
+
+	// notifications are fire-and-forget, give them a moment before exiting
+	wctx, wcancel := context.WithTimeout(context.Background(), 30*time.Second)
+	_ = a.notifier.Hub.Wait(wctx)
+	wcancel()
+
+	if errors.Is(err, runner.ErrBusy) {
+		fmt.Fprintln(os.Stderr, err)
+		return exitBusy
+	}
+	rows := [][]string{{
+		res.Started.In(a.loc).Format(time.RFC3339),
+		res.Duration().Round(time.Millisecond).String(),
+		strconv.Itoa(res.Attendances),
+		strconv.Itoa(res.Submitted),
+		strconv.Itoa(res.Failed),
+		res.Err,
+	}}
+	if perr := out.print(res, []string{"STARTED", "DURATION", "ATTENDANCES", "SUBMITTED", "FAILED", "ERROR"}, rows); perr != nil {
+		fmt.Fprintln(os.Stderr, perr)
+	}
+	switch {
+	case err != nil:
+		return exitFailed
+	case res.Failed > 0:
+		return exitPartial
+	}
+	return exitOK
+}
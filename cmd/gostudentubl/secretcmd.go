@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/emandor/gostudentubl/internal/config"
+	"github.com/emandor/gostudentubl/internal/secrets"
+)
+
+func cmdSecret(args []string) int {
+	sub := ""
+	if len(args) > 0 {
+		sub, args = args[0], args[1:]
+	}
+	switch sub {
+	case "set":
+		return cmdSecretSet(args)
+	case "list":
+		return cmdSecretList(args)
+	case "rotate":
+		return cmdSecretRotate(args)
+	}
+	fmt.Fprintln(os.Stderr, "usage: gostudentubl secret set|list|rotate [flags]")
+	return exitUsage
+}
+
+func openVault() (*secrets.Vault, error) {
+	v, err := config.OpenVault()
+	if err == nil && v == nil {
+		err = errors.New("VAULT_FILE is not set")
+	}
+	return v, err
+}
+
+func cmdSecretSet(args []string) int {
+	fs := newFlagSet("secret set", "NAME", "store a secret read from stdin (first line) in the vault")
+	if fs.Parse(args) != nil || fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	name := strings.ToUpper(fs.Arg(0))
+	if !slices.Contains(config.SecretKeys(), name) {
+		fmt.Fprintf(os.Stderr, "%s is not a secret setting, have %s\n", name, strings.Join(config.SecretKeys(), ", "))
+		return exitUsage
+	}
+
+	v, err := openVault()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	if fi, _ := os.Stdin.Stat(); fi != nil && fi.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprintf(os.Stderr, "%s: ", name)
+	}
+	value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	value = strings.TrimRight(value, "\r\n")
+	if value == "" {
+		fmt.Fprintln(os.Stderr, "empty value, nothing stored", err)
+		return exitFailed
+	}
+	if err := v.Update(func(data map[string]string) { data[name] = value }); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	fmt.Fprintf(os.Stderr, "stored %s\n", name)
+	return exitOK
+}
+
+func cmdSecretList(args []string) int {
+	fs := newFlagSet("secret list", "", "list the names stored in the vault, never the values")
+	out := outputFlag(fs)
+	if fs.Parse(args) != nil || out.valid() != nil {
+		return exitUsage
+	}
+	v, err := openVault()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	names := v.Names()
+	rows := make([][]string, 0, len(names))
+	for _, n := range names {
+		rows = append(rows, []string{n})
+	}
+	if err := out.print(names, []string{"NAME"}, rows); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return exitOK
+}
+
+func cmdSecretRotate(args []string) int {
+	fs := newFlagSet("secret rotate", "", "re-encrypt the vault with a new passphrase or key file")
+	keyFile := fs.String("new-key-file", "", "read the new passphrase from this file instead of VAULT_NEW_PASSPHRASE")
+	if fs.Parse(args) != nil {
+		return exitUsage
+	}
+	pass := os.Getenv("VAULT_NEW_PASSPHRASE")
+	if *keyFile != "" {
+		b, err := os.ReadFile(*keyFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailed
+		}
+		pass = strings.TrimRight(string(b), "\r\n")
+	}
+	if pass == "" {
+		fmt.Fprintln(os.Stderr, "set VAULT_NEW_PASSPHRASE or -new-key-file")
+		return exitUsage
+	}
+
+	v, err := openVault()
+	if err == nil {
+		err = v.Rekey(pass)
+	}
+	if err == nil {
+		err = v.Save()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	fmt.Fprintln(os.Stderr, "vault re-encrypted, update VAULT_PASSPHRASE / VAULT_PASSPHRASE_FILE")
+	return exitOK
+}
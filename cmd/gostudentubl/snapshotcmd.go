@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/emandor/gostudentubl/internal/config"
+	"github.com/emandor/gostudentubl/internal/snapshot"
+)
+
+func cmdSnapshot(args []string) int {
+	sub := ""
+	if len(args) > 0 {
+		sub, args = args[0], args[1:]
+	}
+	switch sub {
+	case "list":
+		return cmdSnapshotList(args)
+	case "open":
+		return cmdSnapshotOpen(args)
+	}
+	fmt.Fprintln(os.Stderr, "usage: gostudentubl snapshot list|open [flags]")
+	return exitUsage
+}
+
+// snapshots does not need a valid config, only where the pages are kept.
+func snapshots() *snapshot.Store {
+	cfg, _ := config.Load()
+	return cfg.Snapshots()
+}
+
+func cmdSnapshotList(args []string) int {
+	fs := newFlagSet("snapshot list", "", "list saved pages the parsers failed on, newest first")
+	out := outputFlag(fs)
+	n := fs.Int("n", 20, "show at most n snapshots, 0 for all")
+	if fs.Parse(args) != nil || out.valid() != nil {
+		return exitUsage
+	}
+	all, err := snapshots().List()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	if *n > 0 && len(all) > *n {
+		all = all[:*n]
+	}
+	rows := make([][]string, 0, len(all))
+	for _, m := range all {
+		rows = append(rows, []string{m.ID, m.At.Local().Format(time.DateTime), strconv.Itoa(m.Status), m.Reason, m.URL})
+	}
+	if err := out.print(all, []string{"ID", "AT", "STATUS", "REASON", "URL"}, rows); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+func cmdSnapshotOpen(args []string) int {
+	fs := newFlagSet("snapshot open", "[ID]", "open a saved page in the browser, the newest without ID.\nID may be a unique prefix")
+	raw := fs.Bool("print", false, "write the HTML to stdout instead")
+	if fs.Parse(args) != nil || fs.NArg() > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	path, m, err := snapshots().Path(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	if *raw {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailed
+		}
+		_, _ = os.Stdout.Write(b)
+		return exitOK
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s (%d) %s\n", m.ID, m.Reason, m.Status, m.URL)
+	if err := browse(path); err != nil {
+		// headless box: the path is still useful
+		fmt.Fprintln(os.Stderr, "cannot start a browser:", err)
+		fmt.Println(path)
+	}
+	return exitOK
+}
+
+func browse(path string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", path).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", path).Start()
+	}
+	return exec.Command("xdg-open", path).Start()
+}
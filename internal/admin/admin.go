@@ -0,0 +1,166 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/emandor/gostudentubl/internal/breaker"
+	"github.com/emandor/gostudentubl/internal/metrics"
+	"github.com/emandor/gostudentubl/internal/runner"
+	"github.com/emandor/gostudentubl/internal/schedule"
+)
+
+// Server is the admin listener for container probes, Prometheus and operators.
+type Server struct {
+	Log    zerolog.Logger
+	Token  string // bearer token for POST /run; empty disables the endpoint
+	Runner *runner.Runner
+	Jobs   *schedule.Jobs
+	// Ctx is cancelled when the daemon shuts down, ending the runs started
+	// through POST /run; nil means context.Background().
+	Ctx context.Context
+}
+
+// Status is the body of GET /status.
+type Status struct {
+	Running     bool               `json:"running"`
+	Paused      bool               `json:"paused"`
+	PausedUntil *time.Time         `json:"paused_until,omitempty"`
+	Scheduler   bool               `json:"scheduler"`
+	Login       runner.LoginStatus `json:"login"`
+	LoginLock   *runner.LoginLock  `json:"login_lock,omitempty"`
+	Breaker     *breaker.State     `json:"breaker,omitempty"`
+	LastRun     *runner.RunResult  `json:"last_run,omitempty"`
+	Next        []schedule.NextRun `json:"next"`
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.healthz)
+	mux.HandleFunc("GET /readyz", s.readyz)
+	mux.HandleFunc("GET /status", s.status)
+	mux.HandleFunc("POST /run", s.run)
+	mux.Handle("GET /metrics", metrics.Handler())
+	return mux
+}
+
+func (s *Server) healthz(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyz wants a running scheduler and a successful latest login.
+func (s *Server) readyz(w http.ResponseWriter, _ *http.Request) {
+	var problems []string
+	if !s.Jobs.Running() {
+		problems = append(problems, "scheduler not running")
+	}
+	switch login := s.Runner.LastLogin(); {
+	case login.At.IsZero():
+		problems = append(problems, "no login yet")
+	case !login.OK:
+		problems = append(problems, "last login failed: "+login.Err)
+	}
+	if lock, ok := s.Runner.LoginLock(); ok {
+		problems = append(problems, "logins disabled after "+lock.Cause)
+	}
+	if s.Runner.Breaker != nil && s.Runner.Breaker.State().Open {
+		problems = append(problems, "e-learning unavailable, breaker open")
+	}
+	if len(problems) > 0 {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "not ready", "problems": problems})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+func (s *Server) status(w http.ResponseWriter, _ *http.Request) {
+	st := Status{
+		Running:   s.Runner.Running(),
+		Scheduler: s.Jobs.Running(),
+		Login:     s.Runner.LastLogin(),
+		Next:      s.Jobs.Next(),
+	}
+	if paused, until := s.Jobs.Paused(); paused {
+		st.Paused = true
+		if !until.IsZero() {
+			st.PausedUntil = &until
+		}
+	}
+	if lock, ok := s.Runner.LoginLock(); ok {
+		st.LoginLock = &lock
+	}
+	if s.Runner.Breaker != nil {
+		b := s.Runner.Breaker.State()
+		st.Breaker = &b
+	}
+	if res, ok := s.Runner.LastResult(); ok {
+		st.LastRun = &res
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+// run starts an attendance run. It answers 202 straight away, or waits
+// for the result with ?wait=1; 409 when a run is already active.
+func (s *Server) run(w http.ResponseWriter, req *http.Request) {
+	if !s.authorized(req) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if s.Runner.Running() {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": runner.ErrBusy.Error()})
+		return
+	}
+	s.Log.Info().Str("remote", req.RemoteAddr).Msg("admin: run requested")
+
+	if req.URL.Query().Get("wait") == "" {
+		go func() {
+			ctx, cancel := context.WithTimeout(s.ctx(), 10*time.Minute)
+			defer cancel()
+			if _, err := s.Runner.Run(ctx); err != nil && !errors.Is(err, runner.ErrBusy) {
+				s.Log.Error().Err(err).Msg("admin: run failed")
+			}
+		}()
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "started"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), 10*time.Minute)
+	defer cancel()
+	res, err := s.Runner.Run(ctx)
+	switch {
+	case errors.Is(err, runner.ErrBusy):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	case err != nil:
+		writeJSON(w, http.StatusBadGateway, res)
+	default:
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+func (s *Server) ctx() context.Context {
+	if s.Ctx == nil {
+		return context.Background()
+	}
+	return s.Ctx
+}
+
+func (s *Server) authorized(req *http.Request) bool {
+	if s.Token == "" {
+		return false
+	}
+	got, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(s.Token)) == 1
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,264 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emandor/gostudentubl/internal/filelock"
+)
+
+// Outcomes of a submission attempt.
+const (
+	OutcomeConfirmed   = "confirmed"   // the session's own row on the view page turned self-recorded
+	OutcomeUnconfirmed = "unconfirmed" // submitted, but the check did not find it
+	OutcomeError       = "error"       // the submit or the check failed
+)
+
+// Entry is one submission attempt. Prev is the Hash of the entry before,
+// and Hash covers every other field, so editing or dropping a line breaks
+// the chain from there on.
+type Entry struct {
+	Seq          int       `json:"seq"`
+	RunID        string    `json:"run_id,omitempty"`
+	SessionID    string    `json:"session_id"`
+	AttendanceID string    `json:"attendance_id"`
+	Attendance   string    `json:"attendance"`
+	CourseID     int       `json:"course_id"`
+	Course       string    `json:"course"`
+	Status       string    `json:"status"` // the status option value that was posted
+	RequestAt    time.Time `json:"request_at"`
+	ResponseAt   time.Time `json:"response_at"`
+	HTTPStatus   int       `json:"http_status"`
+	PageSHA256   string    `json:"page_sha256,omitempty"`
+	Page         string    `json:"page,omitempty"` // stored copy, relative to the log dir
+	Outcome      string    `json:"outcome"`
+	SessionRow   string    `json:"session_row,omitempty"` // the session log row the check judged by
+	Error        string    `json:"error,omitempty"`
+	Prev         string    `json:"prev"`
+	Hash         string    `json:"hash,omitempty"`
+}
+
+func (e Entry) digest() string {
+	e.Hash = ""
+	b, _ := json.Marshal(e)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Log is the append-only audit trail in Dir: audit.jsonl, audit.head with
+// the latest hash (so truncation is caught too) and pages/<sha256>.html.
+// Several processes may append to the same Dir; each Append takes a file
+// lock and chains onto whatever the log ends with at that moment.
+type Log struct {
+	Dir string
+
+	mu sync.Mutex
+}
+
+// ErrHead means audit.head no longer matches the end of the log, so the
+// log was truncated or edited. Append still records the entry but leaves
+// the head alone for audit verify to report.
+var ErrHead = errors.New("audit: head does not match the log")
+
+func (l *Log) file() string { return filepath.Join(l.Dir, "audit.jsonl") }
+func (l *Log) head() string { return filepath.Join(l.Dir, "audit.head") }
+
+// Append stores page (if any) and adds e to the chain.
+func (l *Log) Append(e Entry, page []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.MkdirAll(filepath.Join(l.Dir, "pages"), 0o700); err != nil {
+		return err
+	}
+	unlock, err := filelock.Lock(l.file())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	last, err := lastEntry(l.file())
+	if err != nil {
+		return err
+	}
+	seq, hash, herr := readHead(l.head())
+	// a crash between the log and the head write leaves the head one behind
+	headOK := herr == nil && ((seq == last.Seq && hash == last.Hash) || (seq == last.Seq-1 && hash == last.Prev))
+
+	if len(page) > 0 {
+		sum := sha256.Sum256(page)
+		e.PageSHA256 = hex.EncodeToString(sum[:])
+		e.Page = filepath.Join("pages", e.PageSHA256+".html")
+		if err := os.WriteFile(filepath.Join(l.Dir, e.Page), page, 0o600); err != nil {
+			return err
+		}
+	}
+
+	e.Seq, e.Prev = last.Seq+1, last.Hash
+	e.Hash = e.digest()
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.file(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	switch {
+	case herr != nil:
+		return fmt.Errorf("%w: %w", ErrHead, herr)
+	case !headOK:
+		return fmt.Errorf("%w: head at seq %d, log at seq %d", ErrHead, seq, last.Seq)
+	}
+	return os.WriteFile(l.head(), []byte(fmt.Sprintf("%d %s\n", e.Seq, e.Hash)), 0o600)
+}
+
+// lastEntry reads the final line of the log; the zero Entry when it is
+// missing or empty.
+func lastEntry(path string) (Entry, error) {
+	var e Entry
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return e, nil
+	}
+	if err != nil {
+		return e, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return e, err
+	}
+
+	// entries are a few hundred bytes, the pages live in their own files
+	const tail = 64 * 1024
+	off := max(fi.Size()-tail, 0)
+	buf := make([]byte, fi.Size()-off)
+	if _, err := f.ReadAt(buf, off); err != nil {
+		return e, err
+	}
+	buf = bytes.TrimRight(buf, "\r\n\t ")
+	if len(buf) == 0 {
+		return e, nil
+	}
+	line := buf[bytes.LastIndexByte(buf, '\n')+1:]
+	if err := json.Unmarshal(line, &e); err != nil {
+		return e, fmt.Errorf("%s: last line: %w", path, err)
+	}
+	return e, nil
+}
+
+func readHead(path string) (int, string, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, "", nil
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	var seq int
+	var hash string
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(b)), "%d %s", &seq, &hash); err != nil {
+		return 0, "", fmt.Errorf("%s: %w", path, err)
+	}
+	return seq, hash, nil
+}
+
+// Report is the result of Verify.
+type Report struct {
+	Entries int    `json:"entries"`
+	Head    string `json:"head,omitempty"`
+	// Problems lists every broken link, hash or page, empty when intact.
+	Problems []string `json:"problems,omitempty"`
+}
+
+func (r Report) OK() bool { return len(r.Problems) == 0 }
+
+// Verify walks the whole chain and checks every hash, link and stored page.
+func (l *Log) Verify() (Report, error) {
+	var rep Report
+	f, err := os.Open(l.file())
+	if errors.Is(err, os.ErrNotExist) {
+		return rep, nil
+	}
+	if err != nil {
+		return rep, err
+	}
+	defer f.Close()
+
+	prev := ""
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 4<<20)
+	for line := 1; sc.Scan(); line++ {
+		raw := bytes.TrimSpace(sc.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			rep.Problems = append(rep.Problems, fmt.Sprintf("line %d: %v", line, err))
+			continue
+		}
+		rep.Entries++
+		if e.Seq != rep.Entries {
+			rep.Problems = append(rep.Problems, fmt.Sprintf("line %d: seq %d, want %d", line, e.Seq, rep.Entries))
+		}
+		if e.Prev != prev {
+			rep.Problems = append(rep.Problems, fmt.Sprintf("seq %d: prev does not match the entry before", e.Seq))
+		}
+		if got := e.digest(); got != e.Hash {
+			rep.Problems = append(rep.Problems, fmt.Sprintf("seq %d: hash mismatch, entry was modified", e.Seq))
+		}
+		if e.Page != "" {
+			if err := checkPage(filepath.Join(l.Dir, e.Page), e.PageSHA256); err != nil {
+				rep.Problems = append(rep.Problems, fmt.Sprintf("seq %d: page %s: %v", e.Seq, e.Page, err))
+			}
+		}
+		prev = e.Hash
+	}
+	if err := sc.Err(); err != nil {
+		return rep, err
+	}
+	rep.Head = prev
+
+	seq, hash, err := readHead(l.head())
+	if err != nil {
+		return rep, err
+	}
+	if seq != rep.Entries || hash != prev {
+		rep.Problems = append(rep.Problems, fmt.Sprintf("head says seq %d, log ends at seq %d: entries were added or removed", seq, rep.Entries))
+	}
+	return rep, nil
+}
+
+func checkPage(path, want string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(b)
+	if hex.EncodeToString(sum[:]) != want {
+		return errors.New("content does not match its hash")
+	}
+	return nil
+}
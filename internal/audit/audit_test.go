@@ -0,0 +1,151 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, dir string)
+		want   string // substring of a reported problem; empty means intact
+	}{
+		{name: "intact", tamper: func(*testing.T, string) {}},
+		{name: "tampered line", tamper: func(t *testing.T, dir string) {
+			rewrite(t, filepath.Join(dir, "audit.jsonl"), func(b []byte) []byte {
+				return bytes.Replace(b, []byte(`"outcome":"error"`), []byte(`"outcome":"confirmed"`), 1)
+			})
+		}, want: "seq 2: hash mismatch"},
+		{name: "dropped line", tamper: func(t *testing.T, dir string) {
+			rewrite(t, filepath.Join(dir, "audit.jsonl"), func(b []byte) []byte {
+				lines := strings.SplitAfter(string(b), "\n")
+				return []byte(lines[0] + lines[2])
+			})
+		}, want: "prev does not match"},
+		{name: "truncated log", tamper: func(t *testing.T, dir string) {
+			rewrite(t, filepath.Join(dir, "audit.jsonl"), func(b []byte) []byte {
+				lines := strings.SplitAfter(string(b), "\n")
+				return []byte(lines[0] + lines[1])
+			})
+		}, want: "head says seq 3, log ends at seq 2"},
+		{name: "truncated head", tamper: func(t *testing.T, dir string) {
+			rewrite(t, filepath.Join(dir, "audit.head"), func([]byte) []byte { return nil })
+		}, want: "audit.head"},
+		{name: "page replaced", tamper: func(t *testing.T, dir string) {
+			pages, _ := filepath.Glob(filepath.Join(dir, "pages", "*.html"))
+			if err := os.WriteFile(pages[0], []byte("<p>forged</p>"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}, want: "content does not match its hash"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			l := &Log{Dir: dir}
+			for i, outcome := range []string{OutcomeConfirmed, OutcomeError, OutcomeConfirmed} {
+				page := []byte("<html>confirmation " + string(rune('a'+i)) + "</html>")
+				if err := l.Append(Entry{SessionID: "42", Outcome: outcome}, page); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tt.tamper(t, dir)
+
+			rep, err := l.Verify()
+			if tt.want == "" {
+				if err != nil || !rep.OK() {
+					t.Fatalf("Verify = %v, %v; want intact", rep.Problems, err)
+				}
+				return
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), tt.want) {
+					t.Fatalf("Verify error %v, want %q", err, tt.want)
+				}
+				return
+			}
+			if !hasProblem(rep, tt.want) {
+				t.Errorf("problems %q, want one containing %q", rep.Problems, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendKeepsTruncationVisible(t *testing.T) {
+	dir := t.TempDir()
+	l := &Log{Dir: dir}
+	for _, id := range []string{"1", "2", "3"} {
+		if err := l.Append(Entry{SessionID: id, Outcome: OutcomeConfirmed}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rewrite(t, filepath.Join(dir, "audit.jsonl"), func(b []byte) []byte {
+		return []byte(strings.SplitAfter(string(b), "\n")[0])
+	})
+
+	// two new entries bring the log back to seq 3, with other hashes
+	for _, id := range []string{"4", "5"} {
+		if err := l.Append(Entry{SessionID: id, Outcome: OutcomeConfirmed}, nil); !errors.Is(err, ErrHead) {
+			t.Fatalf("Append after truncation = %v, want ErrHead", err)
+		}
+	}
+	rep, err := l.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasProblem(rep, "head says seq 3, log ends at seq 3") {
+		t.Errorf("problems %q, want the old head to be kept", rep.Problems)
+	}
+}
+
+func TestAppendFromSeveralLogs(t *testing.T) {
+	dir := t.TempDir()
+	// one Log per process, as with the daemon and a CLI run side by side
+	logs := []*Log{{Dir: dir}, {Dir: dir}}
+	var wg sync.WaitGroup
+	for _, l := range logs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				if err := l.Append(Entry{Outcome: OutcomeConfirmed}, nil); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	rep, err := logs[0].Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.OK() || rep.Entries != 20 {
+		t.Errorf("entries %d, problems %q; want 20 intact", rep.Entries, rep.Problems)
+	}
+}
+
+func rewrite(t *testing.T, path string, fn func([]byte) []byte) {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, fn(b), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func hasProblem(rep Report, want string) bool {
+	for _, p := range rep.Problems {
+		if strings.Contains(p, want) {
+			return true
+		}
+	}
+	return false
+}
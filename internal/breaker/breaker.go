@@ -0,0 +1,158 @@
+// Package breaker stops the bot from hammering Moodle while it is down or
+// in maintenance. The state is kept on disk so it holds across runs and
+// restarts.
+package breaker
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/emandor/gostudentubl/internal/filelock"
+)
+
+// State is the breaker as stored in the state file.
+type State struct {
+	Open      bool      `json:"open"`
+	Failures  int       `json:"failures"` // consecutive, while closed
+	Reason    string    `json:"reason,omitempty"`
+	Since     time.Time `json:"since,omitempty"` // opened at
+	Probes    int       `json:"probes"`          // failed probes since opening
+	NextProbe time.Time `json:"next_probe,omitempty"`
+}
+
+// Breaker opens after Threshold failed runs in a row, or at once for a
+// maintenance page. While open the next probe waits ProbeMin, doubling
+// after every failed probe up to ProbeMax. Every call re-reads Path, and
+// changes are made under a file lock, so the daemon and CLI commands
+// sharing the state file see each other's updates.
+type Breaker struct {
+	Path      string
+	Threshold int
+	ProbeMin  time.Duration
+	ProbeMax  time.Duration
+
+	mu sync.Mutex
+	st State // the state itself when Path is empty
+}
+
+// State returns the current state.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.load()
+	return b.st
+}
+
+// Allow reports whether a run may go ahead; probe is true when the breaker
+// is open and the next probe is due, so the caller should check the site
+// with one request before anything else.
+func (b *Breaker) Allow(now time.Time) (ok, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.load()
+	if !b.st.Open {
+		return true, false
+	}
+	due := !now.Before(b.st.NextProbe)
+	return due, due
+}
+
+// Success closes the breaker and reports whether it was open.
+func (b *Breaker) Success() (closed bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	unlock, err := b.lock()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	b.load()
+	if !b.st.Open && b.st.Failures == 0 {
+		return false, nil
+	}
+	closed = b.st.Open
+	b.st = State{}
+	return closed, b.save()
+}
+
+// Failure records a failed run or probe and reports whether the breaker
+// opened just now. immediate opens it regardless of Threshold.
+func (b *Breaker) Failure(now time.Time, reason string, immediate bool) (opened bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	unlock, err := b.lock()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	b.load()
+	b.st.Reason = reason
+	if b.st.Open {
+		b.st.Probes++
+		b.st.NextProbe = now.Add(b.backoff(b.st.Probes))
+		return false, b.save()
+	}
+	b.st.Failures++
+	if immediate || b.st.Failures >= max(b.Threshold, 1) {
+		b.st.Open, b.st.Since, b.st.Probes = true, now, 0
+		b.st.NextProbe = now.Add(b.backoff(0))
+		opened = true
+	}
+	return opened, b.save()
+}
+
+func (b *Breaker) backoff(probes int) time.Duration {
+	d := b.ProbeMin
+	for range probes {
+		d *= 2
+		if b.ProbeMax > 0 && d >= b.ProbeMax {
+			return b.ProbeMax
+		}
+	}
+	return d
+}
+
+// lock serialises read-modify-write cycles with other processes.
+func (b *Breaker) lock() (func(), error) {
+	if b.Path == "" {
+		return func() {}, nil
+	}
+	return filelock.Lock(b.Path)
+}
+
+// load reads the state as another process may have left it; save replaces
+// the file atomically, so reading needs no lock.
+func (b *Breaker) load() {
+	if b.Path == "" {
+		return
+	}
+	b.st = State{}
+	if raw, err := os.ReadFile(b.Path); err == nil {
+		_ = json.Unmarshal(raw, &b.st)
+	}
+}
+
+func (b *Breaker) save() error {
+	if b.Path == "" {
+		return nil
+	}
+	raw, err := json.MarshalIndent(b.st, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(b.Path), 0o755); err != nil {
+		return err
+	}
+	tmp := b.Path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.Path)
+}
+
+// ErrOpen is returned for runs skipped while the breaker is open.
+var ErrOpen = errors.New("e-learning unavailable, breaker open")
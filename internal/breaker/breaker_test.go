@@ -0,0 +1,58 @@
+package breaker
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSharedStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breaker.json")
+	daemon := &Breaker{Path: path, Threshold: 2, ProbeMin: time.Minute, ProbeMax: time.Hour}
+	cli := &Breaker{Path: path, Threshold: 2, ProbeMin: time.Minute, ProbeMax: time.Hour}
+	now := time.Now()
+
+	// the daemon looked at the state before the CLI runs
+	if ok, _ := daemon.Allow(now); !ok {
+		t.Fatal("closed breaker refused a run")
+	}
+	if _, err := cli.Failure(now, "502", false); err != nil {
+		t.Fatal(err)
+	}
+	opened, err := daemon.Failure(now, "502", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opened {
+		t.Fatal("second failure across processes did not open the breaker")
+	}
+	if ok, _ := cli.Allow(now); ok {
+		t.Error("CLI still allowed after the daemon opened the breaker")
+	}
+
+	if closed, err := cli.Success(); err != nil || !closed {
+		t.Fatalf("Success = %v, %v; want closed", closed, err)
+	}
+	if st := daemon.State(); st.Open || st.Failures != 0 {
+		t.Errorf("daemon sees %+v after the CLI closed the breaker", st)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := &Breaker{ProbeMin: time.Minute, ProbeMax: 5 * time.Minute}
+	tests := []struct {
+		probes int
+		want   time.Duration
+	}{
+		{0, time.Minute},
+		{1, 2 * time.Minute},
+		{2, 4 * time.Minute},
+		{3, 5 * time.Minute},
+		{10, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := b.backoff(tt.probes); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.probes, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package chatops
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/emandor/gostudentubl/internal/notify"
+	"github.com/emandor/gostudentubl/internal/runner"
+	"github.com/emandor/gostudentubl/internal/schedule"
+)
+
+// Server answers chat commands posted by the WhatsApp gateway or a Telegram bot webhook.
+type Server struct {
+	Log    zerolog.Logger
+	Secret string
+	Allow  []string // sender IDs allowed to issue commands
+	Runner *runner.Runner
+	Jobs   *schedule.Jobs
+	Hub    *notify.Hub
+	Loc    *time.Location
+	// Ctx is cancelled when the daemon shuts down, ending runs started
+	// from chat; nil means context.Background().
+	Ctx context.Context
+}
+
+// inbound is a command after the payload shape has been worked out.
+type inbound struct {
+	Backend string // where the reply goes
+	Chat    string // reply target
+	Sender  string // checked against Allow
+	Text    string
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /chatops", s.handle)
+	return mux
+}
+
+func (s *Server) handle(w http.ResponseWriter, req *http.Request) {
+	if !s.authorized(req) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	raw, err := io.ReadAll(io.LimitReader(req.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	in, ok := parseInbound(raw)
+	if !ok || !strings.HasPrefix(in.Text, "/") {
+		// not a command (or an event we do not care about), ack so the gateway does not retry
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !s.allowed(in.Sender) {
+		s.Log.Warn().Str("sender", in.Sender).Str("text", in.Text).Msg("chatops: sender not allowed")
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	s.Log.Info().Str("sender", in.Sender).Str("cmd", in.Text).Msg("chatops command")
+	reply := s.exec(in)
+	s.reply(in, reply)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"reply": reply})
+}
+
+// authorized checks the shared secret from our header or Telegram's
+// secret_token header. A ?secret= query is the last resort for gateways
+// that cannot set headers: proxies and access logs keep the URL, secret
+// included, so it is accepted with a warning each time.
+func (s *Server) authorized(req *http.Request) bool {
+	if s.Secret == "" {
+		return false
+	}
+	ok := func(got string) bool {
+		return got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(s.Secret)) == 1
+	}
+	if ok(req.Header.Get("X-Chatops-Secret")) || ok(req.Header.Get("X-Telegram-Bot-Api-Secret-Token")) {
+		return true
+	}
+	if ok(req.URL.Query().Get("secret")) {
+		s.Log.Warn().Msg("chatops: secret sent in the query string, where access logs keep it; use the X-Chatops-Secret header if the gateway can")
+		return true
+	}
+	return false
+}
+
+func (s *Server) allowed(sender string) bool {
+	bare := stripWhatsAppSuffix(sender)
+	for _, a := range s.Allow {
+		if a == sender || stripWhatsAppSuffix(a) == bare {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) reply(in inbound, text string) {
+	if in.Chat == "" || !s.Hub.Has(in.Backend) {
+		return
+	}
+	s.Hub.Dispatch(s.Log.WithContext(context.Background()), []notify.Delivery{{Backend: in.Backend, To: in.Chat, Message: notify.Message{Text: text}}})
+}
+
+func (s *Server) exec(in inbound) string {
+	cmd, args := command(in.Text)
+	switch cmd {
+	case "/status":
+		return s.status()
+	case "/run":
+		return s.run(in)
+	case "/pause":
+		var d time.Duration
+		if len(args) > 0 {
+			var err error
+			if d, err = time.ParseDuration(args[0]); err != nil || d <= 0 {
+				return "usage: /pause [duration], e.g. /pause 2h"
+			}
+		}
+		s.Jobs.Pause(d)
+		if d == 0 {
+			return "⏸️ paused until /resume"
+		}
+		return "⏸️ paused until " + s.fmtTime(time.Now().Add(d))
+	case "/resume":
+		s.Jobs.Resume()
+		return "▶️ resumed"
+	case "/unlock":
+		if _, ok := s.Runner.LoginLock(); !ok {
+			return "logins are not disabled"
+		}
+		if err := s.Runner.UnlockLogin(); err != nil {
+			return "❌ " + err.Error()
+		}
+		return "🔓 logins enabled again, the next run will try to log in"
+	case "/courses":
+		return s.courses(in)
+	case "/next":
+		return s.next()
+	case "/help":
+		return help
+	default:
+		return "unknown command " + cmd + "\n\n" + help
+	}
+}
+
+// command splits a message into the lower-cased command and its arguments.
+func command(text string) (string, []string) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	cmd := strings.ToLower(fields[0])
+	// telegram appends the bot name in groups: /status@my_bot
+	cmd, _, _ = strings.Cut(cmd, "@")
+	return cmd, fields[1:]
+}
+
+const help = `commands:
+/status – last run, pause state
+/run – run attendance now
+/pause [2h] – skip scheduled runs
+/resume – undo /pause
+/unlock – allow logins again after rejected credentials
+/courses – current courses
+/next – upcoming scheduled runs`
+
+func (s *Server) status() string {
+	var b strings.Builder
+	if paused, until := s.Jobs.Paused(); paused {
+		if until.IsZero() {
+			b.WriteString("⏸️ paused until /resume\n")
+		} else {
+			fmt.Fprintf(&b, "⏸️ paused until %s\n", s.fmtTime(until))
+		}
+	} else {
+		b.WriteString("▶️ active\n")
+	}
+	if s.Runner.Running() {
+		b.WriteString("🏃 a run is in progress\n")
+	}
+	if s.Runner.Breaker != nil {
+		if st := s.Runner.Breaker.State(); st.Open {
+			fmt.Fprintf(&b, "🚧 e-learning down since %s, next probe %s\n", s.fmtTime(st.Since), s.fmtTime(st.NextProbe))
+		}
+	}
+	if lock, ok := s.Runner.LoginLock(); ok {
+		fmt.Fprintf(&b, "🔒 logins disabled since %s: %s, /unlock after fixing\n", s.fmtTime(lock.At), lock.Cause)
+	}
+	if res, ok := s.Runner.LastResult(); ok {
+		fmt.Fprintf(&b, "last run: %s (%s)\n", s.fmtTime(res.Started), res.Duration().Round(time.Second))
+		fmt.Fprintf(&b, "sessions: %d, submitted: %d, failed: %d\n", res.Attendances, res.Submitted, res.Failed)
+		if res.Err != "" {
+			fmt.Fprintf(&b, "error: %s\n", res.Err)
+		}
+	} else {
+		b.WriteString("no run yet\n")
+	}
+	if next := s.Jobs.Next(); len(next) > 0 {
+		fmt.Fprintf(&b, "next: %s %s", next[0].Job, s.fmtTime(next[0].At))
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func (s *Server) ctx() context.Context {
+	if s.Ctx == nil {
+		return context.Background()
+	}
+	return s.Ctx
+}
+
+// run starts a run in the background and reports back when it is done.
+func (s *Server) run(in inbound) string {
+	if s.Runner.Running() {
+		return runner.ErrBusy.Error()
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(s.ctx(), 10*time.Minute)
+		defer cancel()
+		res, err := s.Runner.Run(ctx)
+		switch {
+		case errors.Is(err, runner.ErrBusy):
+			s.reply(in, err.Error())
+		case err != nil:
+			s.reply(in, "❌ run failed: "+err.Error())
+		default:
+			s.reply(in, fmt.Sprintf("✅ run done in %s: %d sessions, %d submitted, %d failed",
+				res.Duration().Round(time.Second), res.Attendances, res.Submitted, res.Failed))
+		}
+	}()
+	return "🚀 run started"
+}
+
+// courses logs in and lists the courses in the background, like run: the
+// webhook is answered before the chat platform gives up and retries.
+func (s *Server) courses(in inbound) string {
+	if s.Runner.Running() {
+		return runner.ErrBusy.Error()
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(s.ctx(), 2*time.Minute)
+		defer cancel()
+		cs, err := s.Runner.Courses(ctx)
+		switch {
+		case err != nil:
+			s.reply(in, "❌ "+err.Error())
+		case len(cs) == 0:
+			s.reply(in, "no courses this periode")
+		default:
+			var b strings.Builder
+			for _, c := range cs {
+				fmt.Fprintf(&b, "• %s (%s, id %d)\n", c.CourseName, c.Group, c.CourseID)
+			}
+			s.reply(in, strings.TrimSpace(b.String()))
+		}
+	}()
+	return "📚 fetching courses…"
+}
+
+func (s *Server) next() string {
+	next := s.Jobs.Next()
+	if len(next) == 0 {
+		return "nothing scheduled"
+	}
+	var b strings.Builder
+	for i, n := range next {
+		if i == 5 {
+			break
+		}
+		fmt.Fprintf(&b, "• %s – %s\n", s.fmtTime(n.At), n.Job)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func (s *Server) fmtTime(t time.Time) string {
+	if s.Loc != nil {
+		t = t.In(s.Loc)
+	}
+	return t.Format("Mon 02 Jan 15:04 MST")
+}
@@ -0,0 +1,137 @@
+package chatops
+
+import (
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/emandor/gostudentubl/internal/notify"
+)
+
+func TestAuthorized(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		target string
+		header map[string]string
+		want   bool
+	}{
+		{name: "our header", secret: "s3cret", target: "/chatops", header: map[string]string{"X-Chatops-Secret": "s3cret"}, want: true},
+		{name: "telegram header", secret: "s3cret", target: "/chatops", header: map[string]string{"X-Telegram-Bot-Api-Secret-Token": "s3cret"}, want: true},
+		{name: "query", secret: "s3cret", target: "/chatops?secret=s3cret", want: true},
+		{name: "wrong header", secret: "s3cret", target: "/chatops", header: map[string]string{"X-Chatops-Secret": "guess"}},
+		{name: "prefix of the secret", secret: "s3cret", target: "/chatops", header: map[string]string{"X-Chatops-Secret": "s3c"}},
+		{name: "wrong query", secret: "s3cret", target: "/chatops?secret=guess"},
+		{name: "none sent", secret: "s3cret", target: "/chatops"},
+		{name: "no secret configured", target: "/chatops?secret=", header: map[string]string{"X-Chatops-Secret": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.target, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			s := &Server{Secret: tt.secret, Log: zerolog.Nop()}
+			if got := s.authorized(req); got != tt.want {
+				t.Errorf("authorized = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	s := &Server{Allow: []string{"6281234567890", "120363@g.us", "987654321", "6289999@s.whatsapp.net"}}
+	tests := []struct {
+		sender string
+		want   bool
+	}{
+		{sender: "6281234567890", want: true},
+		{sender: "6281234567890@c.us", want: true},
+		{sender: "6281234567890@s.whatsapp.net", want: true},
+		{sender: "6289999@c.us", want: true},
+		{sender: "987654321", want: true}, // telegram user ID
+		{sender: "120363@g.us", want: true},
+		{sender: "6281234567891@c.us"},
+		{sender: "628123456789@c.us"},
+		{sender: "120363"}, // a group is only allowed with its suffix
+		{sender: ""},
+	}
+	for _, tt := range tests {
+		if got := s.allowed(tt.sender); got != tt.want {
+			t.Errorf("allowed(%q) = %v, want %v", tt.sender, got, tt.want)
+		}
+	}
+}
+
+func TestParseInbound(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want inbound
+		ok   bool
+	}{
+		{
+			name: "telegram private",
+			raw:  `{"update_id": 10, "message": {"text": " /status ", "chat": {"id": 42}, "from": {"id": 42}}}`,
+			want: inbound{Backend: notify.BackendTelegram, Chat: "42", Sender: "42", Text: "/status"}, ok: true,
+		},
+		{
+			name: "telegram group",
+			raw:  `{"update_id": 11, "message": {"text": "/run@attend_bot", "chat": {"id": -100123}, "from": {"id": 42}}}`,
+			want: inbound{Backend: notify.BackendTelegram, Chat: "-100123", Sender: "42", Text: "/run@attend_bot"}, ok: true,
+		},
+		{name: "telegram edit without message", raw: `{"update_id": 12, "edited_message": {"text": "/run"}}`},
+		{
+			name: "flat gateway private",
+			raw:  `{"from": "6281234567890@c.us", "message": "/status"}`,
+			want: inbound{Backend: notify.BackendWhatsApp, Chat: "6281234567890@c.us", Sender: "6281234567890@c.us", Text: "/status"}, ok: true,
+		},
+		{
+			name: "flat gateway group",
+			raw:  `{"from": "120363@g.us", "chatId": "120363@g.us", "sender": "6281234567890@c.us", "text": "/run"}`,
+			want: inbound{Backend: notify.BackendWhatsApp, Chat: "120363@g.us", Sender: "6281234567890@c.us", Text: "/run"}, ok: true,
+		},
+		{
+			name: "waha group participant",
+			raw:  `{"event": "message", "payload": {"from": "120363@g.us", "participant": "6281234567890@c.us", "body": "/pause 2h"}}`,
+			want: inbound{Backend: notify.BackendWhatsApp, Chat: "120363@g.us", Sender: "6281234567890@c.us", Text: "/pause 2h"}, ok: true,
+		},
+		{
+			name: "waha private",
+			raw:  `{"event": "message", "payload": {"from": "6281234567890@c.us", "body": "/next"}}`,
+			want: inbound{Backend: notify.BackendWhatsApp, Chat: "6281234567890@c.us", Sender: "6281234567890@c.us", Text: "/next"}, ok: true,
+		},
+		{name: "waha ack event", raw: `{"event": "message.ack", "payload": {"from": "6281234567890@c.us"}}`},
+		{name: "not JSON", raw: `from=628&message=/run`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseInbound([]byte(tt.raw))
+			if ok != tt.ok || (ok && got != tt.want) {
+				t.Errorf("parseInbound = %+v, %v; want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		text string
+		cmd  string
+		args []string
+	}{
+		{text: "/status", cmd: "/status"},
+		{text: "/Status@Attend_Bot", cmd: "/status"},
+		{text: "/pause@attend_bot 2h", cmd: "/pause", args: []string{"2h"}},
+		{text: "  /pause   30m  ", cmd: "/pause", args: []string{"30m"}},
+		{text: "", cmd: ""},
+	}
+	for _, tt := range tests {
+		cmd, args := command(tt.text)
+		if cmd != tt.cmd || !slices.Equal(args, tt.args) {
+			t.Errorf("command(%q) = %q, %q; want %q, %q", tt.text, cmd, args, tt.cmd, tt.args)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package chatops
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/emandor/gostudentubl/internal/notify"
+)
+
+// telegramUpdate is the part of a Bot API update we read.
+type telegramUpdate struct {
+	UpdateID int `json:"update_id"`
+	Message  *struct {
+		Text string `json:"text"`
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		From struct {
+			ID int64 `json:"id"`
+		} `json:"from"`
+	} `json:"message"`
+}
+
+// whatsappMessage covers the flat gateway shape ({from, chatId, message})
+// and WAHA's {"event": "message", "payload": {from, body}}.
+type whatsappMessage struct {
+	From    string `json:"from"`
+	ChatID  string `json:"chatId"`
+	Sender  string `json:"sender"`
+	Message string `json:"message"`
+	Text    string `json:"text"`
+	Body    string `json:"body"`
+	Payload *struct {
+		From        string `json:"from"`
+		Participant string `json:"participant"`
+		Body        string `json:"body"`
+	} `json:"payload"`
+}
+
+func parseInbound(raw []byte) (inbound, bool) {
+	var tg telegramUpdate
+	if json.Unmarshal(raw, &tg) == nil && tg.UpdateID != 0 {
+		if tg.Message == nil {
+			return inbound{}, false
+		}
+		return inbound{
+			Backend: notify.BackendTelegram,
+			Chat:    strconv.FormatInt(tg.Message.Chat.ID, 10),
+			Sender:  strconv.FormatInt(tg.Message.From.ID, 10),
+			Text:    strings.TrimSpace(tg.Message.Text),
+		}, true
+	}
+
+	var wa whatsappMessage
+	if json.Unmarshal(raw, &wa) != nil {
+		return inbound{}, false
+	}
+	in := inbound{Backend: notify.BackendWhatsApp}
+	if p := wa.Payload; p != nil {
+		in.Chat = p.From
+		// in groups "from" is the group and the participant is the person
+		in.Sender = firstNonEmpty(p.Participant, p.From)
+		in.Text = p.Body
+	} else {
+		in.Chat = firstNonEmpty(wa.ChatID, wa.From)
+		in.Sender = firstNonEmpty(wa.Sender, wa.From)
+		in.Text = firstNonEmpty(wa.Message, wa.Text, wa.Body)
+	}
+	in.Text = strings.TrimSpace(in.Text)
+	return in, in.Sender != "" && in.Text != ""
+}
+
+func stripWhatsAppSuffix(id string) string {
+	for _, suf := range []string{"@c.us", "@s.whatsapp.net"} {
+		id = strings.TrimSuffix(id, suf)
+	}
+	return id
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -1,49 +1,273 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/caarlos0/env/v10"
+
+	"github.com/emandor/gostudentubl/internal/moodle"
+	"github.com/emandor/gostudentubl/internal/snapshot"
 )
 
 type Config struct {
+	// ConfigFile is a YAML or TOML file whose keys are the env var names
+	// below; the environment always wins over it.
+	ConfigFile string `env:"CONFIG_FILE"`
+
 	Timezone string `env:"TIMEZONE,required"`
 	Username string `env:"USERNAME,required"`
-	Password string `env:"PASSWORD,required"`
+	Password string `env:"PASSWORD,required" secret:"true"`
+	// FullName, when set, must show in the user menu after login.
+	FullName string `env:"FULL_NAME"`
+
+	// MoodleBaseURL derives every endpoint from the MoodleSite profile;
+	// MoodlePaths overrides single paths, e.g. "courses:/my/courses.php".
+	MoodleBaseURL string            `env:"MOODLE_BASE_URL"`
+	MoodleSite    string            `env:"MOODLE_SITE"`
+	MoodlePaths   map[string]string `env:"MOODLE_PATHS"`
+	// MoodleProfile picks the selector/label set: en or id. A JSON
+	// MoodleProfileFile wins over it for custom themes.
+	MoodleProfile     string `env:"MOODLE_PROFILE"`
+	MoodleProfileFile string `env:"MOODLE_PROFILE_FILE"`
 
-	LoginURL          string `env:"LOGIN_URL,required"`
-	CoursesURL        string `env:"COURSES_URL,required"`
-	AttendanceListURL string `env:"ATTENDANCE_LIST_URL,required"`
-	AttendanceURL     string `env:"ATTENDANCE_URL,required"`
-	AttendanceFormURL string `env:"ATTENDANCE_FORM_URL,required"`
+	// The full URLs still win over the derived ones and are required
+	// only when MOODLE_BASE_URL is not set.
+	LoginURL          string `env:"LOGIN_URL"`
+	LogoutURL         string `env:"LOGOUT_URL"`
+	CoursesURL        string `env:"COURSES_URL"`
+	AttendanceListURL string `env:"ATTENDANCE_LIST_URL"`
+	AttendanceURL     string `env:"ATTENDANCE_URL"`
+	AttendanceFormURL string `env:"ATTENDANCE_FORM_URL"`
 	CurrentPeriode    string `env:"CURRENT_PERIODE"`
 
 	WAEndpoint string `env:"WA_ENDPOINT,required"`
-	WAToken    string `env:"WA_TOKEN,required"`
+	WAToken    string `env:"WA_TOKEN,required" secret:"true"`
 	WAMe       string `env:"WA_ME"`
 	WaGroup    string `env:"WA_GROUP"`
+	// WAProvider picks the gateway adapter: gateway, waha, fonnte, wablas or twilio.
+	WAProvider   string `env:"WA_PROVIDER"`
+	WASession    string `env:"WA_SESSION"`     // waha
+	WAFrom       string `env:"WA_FROM"`        // twilio
+	WAAccountSID string `env:"WA_ACCOUNT_SID"` // twilio
+
+	NotifyLocale      string `env:"NOTIFY_LOCALE"`       // id or en
+	NotifyTemplateDir string `env:"NOTIFY_TEMPLATE_DIR"` // overrides <dir>/<locale>/<event>.<me|group>.tmpl
+	NotifyRoutesFile  string `env:"NOTIFY_ROUTES_FILE"`  // JSON routing table, defaults to me+group
+
+	TelegramBotToken string `env:"TELEGRAM_BOT_TOKEN" secret:"true"`
+
+	// ChatOps listens for chat commands when ChatOpsAddr is set, e.g. ":8081".
+	// Gateways send ChatOpsSecret in the X-Chatops-Secret header; ?secret=
+	// works too but lands in access logs.
+	ChatOpsAddr   string   `env:"CHATOPS_ADDR"`
+	ChatOpsSecret string   `env:"CHATOPS_SECRET" secret:"true"`
+	ChatOpsAllow  []string `env:"CHATOPS_ALLOW"` // sender IDs: phone numbers / Telegram user IDs
+
+	// AdminAddr serves /healthz, /readyz, /status, /metrics and POST /run, e.g.
+	// ":8080"; AdminToken is the bearer token POST /run requires.
+	AdminAddr  string `env:"ADMIN_ADDR"`
+	AdminToken string `env:"ADMIN_TOKEN" secret:"true"`
+
+	// webhook URLs carry their own token, so they are masked like passwords
+	DiscordWebhookURL   string            `env:"DISCORD_WEBHOOK_URL" secret:"true"`
+	SlackWebhookURL     string            `env:"SLACK_WEBHOOK_URL" secret:"true"`
+	WebhookURL          string            `env:"WEBHOOK_URL" secret:"true"`
+	WebhookHeaders      map[string]string `env:"WEBHOOK_HEADERS" secret:"true"` // e.g. "X-Api-Key:abc,X-Source:bot"
+	WebhookTemplateFile string            `env:"WEBHOOK_TEMPLATE_FILE"`
 
 	CronWeekday string `env:"CRON_WEEKDAY"`
 	CronWeekend string `env:"CRON_WEEKEND"`
+	// DigestCron enables the summary job when set; DigestPeriod is day or week.
+	DigestCron   string `env:"DIGEST_CRON"`
+	DigestPeriod string `env:"DIGEST_PERIOD"`
+
+	StateDir string `env:"STATE_DIR"` // run history and other persisted state
 
-	Concurrency       int     `env:"CONCURRENCY"`
-	RatePerSec        float64 `env:"RATE_PER_SEC"`
-	RateBurst         int     `env:"RATE_BURST"`
-	RequestTimeoutSec int     `env:"REQUEST_TIMEOUT_SEC"`
-	DryRun            bool    `env:"DRY_RUN"`
+	// SnapshotDir receives pages the parsers failed on, default
+	// <STATE_DIR>/snapshots; only the newest SnapshotKeep younger than
+	// SnapshotMaxAgeDays are kept, 0 lifts either limit.
+	SnapshotDir        string `env:"SNAPSHOT_DIR"`
+	SnapshotKeep       int    `env:"SNAPSHOT_KEEP"`
+	SnapshotMaxAgeDays int    `env:"SNAPSHOT_MAX_AGE_DAYS"`
+
+	LogLevel      string `env:"LOG_LEVEL"`  // trace, debug, info, warn, error
+	LogFormat     string `env:"LOG_FORMAT"` // json or console
+	LogFile       string `env:"LOG_FILE"`   // empty disables the file
+	LogMaxSizeMB  int    `env:"LOG_MAX_SIZE_MB"`
+	LogMaxBackups int    `env:"LOG_MAX_BACKUPS"`
+	LogMaxAgeDays int    `env:"LOG_MAX_AGE_DAYS"`
+	LogCompress   bool   `env:"LOG_COMPRESS"`
+	LogStdout     bool   `env:"LOG_STDOUT"` // stderr for one-shot commands
+
+	// TraceExporter sends run and request spans to an OTLP/HTTP collector
+	// at TraceEndpoint, or prints them with "stdout".
+	TraceExporter string `env:"TRACE_EXPORTER"` // none, otlp or stdout
+	TraceEndpoint string `env:"TRACE_ENDPOINT"` // host:port
+	TraceInsecure bool   `env:"TRACE_INSECURE"`
+
+	// VaultFile is an encrypted store for the secrets above and the Moodle
+	// session cookies. VAULT_PASSPHRASE_FILE doubles as a key file.
+	VaultFile       string `env:"VAULT_FILE"`
+	VaultPassphrase string `env:"VAULT_PASSPHRASE" secret:"true"`
+
+	// BreakerThreshold failed runs in a row (0 disables) make the bot stop
+	// and only probe Moodle, first after BreakerProbeMinSec, doubling up to
+	// BreakerProbeMaxSec. A maintenance page opens the breaker at once.
+	BreakerThreshold   int `env:"BREAKER_THRESHOLD"`
+	BreakerProbeMinSec int `env:"BREAKER_PROBE_MIN_SEC"`
+	BreakerProbeMaxSec int `env:"BREAKER_PROBE_MAX_SEC"`
+
+	Concurrency int `env:"CONCURRENCY"`
+	// RatePerSec and RateBurst limit every request to Moodle, retries
+	// included; RateEndpoints adds limits per endpoint, e.g. "submit:0.2".
+	// RunMaxRequests caps the requests of one run, 0 disables the cap.
+	RatePerSec        float64            `env:"RATE_PER_SEC"`
+	RateBurst         int                `env:"RATE_BURST"`
+	RateEndpoints     map[string]float64 `env:"RATE_ENDPOINTS"`
+	RunMaxRequests    int                `env:"RUN_MAX_REQUESTS"`
+	RequestTimeoutSec int                `env:"REQUEST_TIMEOUT_SEC"`
+	DryRun            bool               `env:"DRY_RUN"`
 }
 
+// Load reads the optional CONFIG_FILE (YAML or TOML), the vault and the
+// environment, lowest to highest precedence, then validates the result.
+// Every secret may also be given as KEY_FILE. Every problem is reported
+// at once via errors.Join.
 func Load() (Config, error) {
-	cfg := Config{
-		Timezone:          "Asia/Jakarta",
-		CronWeekday:       "1 8,12,13,14,19 * * 1-5",
-		CronWeekend:       "0 8,9,11,14,16 * * 6",
-		Concurrency:       4,
-		RatePerSec:        1,
-		RateBurst:         2,
-		RequestTimeoutSec: 15,
-	}
-	return cfg, env.Parse(&cfg)
+	cfg, _, err := load()
+	return cfg, err
+}
+
+func load() (Config, map[string]string, error) {
+	cfg := defaults()
+	vars, src, err := layers()
+	if err == nil {
+		err = applyVault(vars, src)
+	}
+	if err != nil {
+		return cfg, nil, err
+	}
+	err = env.ParseWithOptions(&cfg, env.Options{Environment: vars})
+	return cfg, src, errors.Join(err, cfg.Validate())
+}
+
+// layers merges the config file and the environment, then resolves the
+// *_FILE secrets. src records where each key came from.
+func layers() (vars, src map[string]string, err error) {
+	vars, src = map[string]string{}, map[string]string{}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		fv, err := readFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		for k, v := range fv {
+			vars[k], src[k] = v, "file"
+		}
+	}
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		vars[k] = v
+		if known(k) {
+			src[k] = "env"
+		}
+	}
+	return vars, src, secretFiles(vars, src)
+}
+
+func defaults() Config {
+	return Config{
+		Timezone:           "Asia/Jakarta",
+		MoodleSite:         "moodle",
+		MoodleProfile:      "en",
+		WAProvider:         "gateway",
+		NotifyLocale:       "id",
+		CronWeekday:        "1 8,12,13,14,19 * * 1-5",
+		CronWeekend:        "0 8,9,11,14,16 * * 6",
+		DigestPeriod:       "day",
+		StateDir:           "state",
+		SnapshotKeep:       50,
+		SnapshotMaxAgeDays: 30,
+		LogLevel:           "info",
+		LogFormat:          "json",
+		LogFile:            "logs/app.log",
+		LogMaxSizeMB:       10,
+		LogMaxBackups:      3,
+		LogMaxAgeDays:      28,
+		LogCompress:        true,
+		LogStdout:          true,
+		TraceExporter:      "none",
+		TraceEndpoint:      "localhost:4318",
+		TraceInsecure:      true,
+		BreakerThreshold:   3,
+		BreakerProbeMinSec: 300,
+		BreakerProbeMaxSec: 3600,
+		Concurrency:        4,
+		RatePerSec:         1,
+		RateBurst:          2,
+		RunMaxRequests:     300,
+		RequestTimeoutSec:  15,
+	}
+}
+
+// Endpoints resolves the Moodle URLs: the site profile joined onto
+// MOODLE_BASE_URL first, then any *_URL variable that is set on its own.
+func (c Config) Endpoints() (moodle.Endpoints, error) {
+	var e moodle.Endpoints
+	if c.MoodleBaseURL != "" {
+		site, ok := moodle.Sites[c.MoodleSite]
+		if !ok {
+			return e, fmt.Errorf("unknown MOODLE_SITE %q, have %s", c.MoodleSite, strings.Join(moodle.SiteNames(), ", "))
+		}
+		site, err := site.With(c.MoodlePaths)
+		if err != nil {
+			return e, fmt.Errorf("MOODLE_PATHS: %w", err)
+		}
+		if e, err = site.Endpoints(c.MoodleBaseURL); err != nil {
+			return e, fmt.Errorf("MOODLE_BASE_URL: %w", err)
+		}
+	}
+	for _, o := range []struct {
+		dst *string
+		val string
+	}{
+		{&e.LoginURL, c.LoginURL},
+		{&e.LogoutURL, c.LogoutURL},
+		{&e.CoursesURL, c.CoursesURL},
+		{&e.AttendanceListURL, c.AttendanceListURL},
+		{&e.AttendanceURL, c.AttendanceURL},
+		{&e.AttendanceFormURL, c.AttendanceFormURL},
+	} {
+		if o.val != "" {
+			*o.dst = o.val
+		}
+	}
+	return e, nil
+}
+
+// Profile returns the parser profile from MOODLE_PROFILE_FILE or MOODLE_PROFILE.
+func (c Config) Profile() (moodle.Profile, error) {
+	if c.MoodleProfileFile != "" {
+		return moodle.LoadProfile(c.MoodleProfileFile)
+	}
+	p, ok := moodle.Profiles[c.MoodleProfile]
+	if !ok {
+		return p, fmt.Errorf("unknown MOODLE_PROFILE %q, have %s", c.MoodleProfile, strings.Join(moodle.ProfileNames(), ", "))
+	}
+	return p, nil
+}
+
+// Snapshots returns the store for pages the parsers failed on.
+func (c Config) Snapshots() *snapshot.Store {
+	dir := c.SnapshotDir
+	if dir == "" {
+		dir = filepath.Join(c.StateDir, "snapshots")
+	}
+	return &snapshot.Store{Dir: dir, Keep: c.SnapshotKeep, MaxAge: time.Duration(c.SnapshotMaxAgeDays) * 24 * time.Hour}
 }
 
 func (c Config) RequestTimeout() time.Duration {
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := defaults()
+	cfg.MoodleBaseURL = "https://moodle.example.ac.id"
+	cfg.WAEndpoint = "https://wa.example.com/send"
+	cfg.Timezone = "Mars/Olympus"
+	cfg.WebhookURL = "ftp://hooks.example.com/T0KEN-s3cr3t"
+	cfg.DiscordWebhookURL = "discord.com/api/webhooks/1/T0KEN-s3cr3t"
+	cfg.CronWeekday = "every morning"
+	cfg.LogLevel = "loud"
+	cfg.Concurrency = 0
+	cfg.RateEndpoints = map[string]float64{"grades": 1}
+	cfg.ChatOpsAddr = ":8081"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate accepted the config")
+	}
+	msg := err.Error()
+	for _, key := range []string{"TIMEZONE", "WEBHOOK_URL", "DISCORD_WEBHOOK_URL", "CRON_WEEKDAY", "LOG_LEVEL", "CONCURRENCY", "RATE_ENDPOINTS", "CHATOPS_ADDR"} {
+		if !strings.Contains(msg, key+":") {
+			t.Errorf("no %s problem in:\n%s", key, msg)
+		}
+	}
+	if strings.Contains(msg, "T0KEN") {
+		t.Errorf("a URL value leaked into the error:\n%s", msg)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(c *Config)
+		want string // key of the expected problem, empty for none
+	}{
+		{name: "defaults with a base URL", edit: func(c *Config) {}},
+		{name: "no base URL nor full URLs", edit: func(c *Config) { c.MoodleBaseURL = "" }, want: "LOGIN_URL"},
+		{name: "full URLs instead of a base URL", edit: func(c *Config) {
+			c.MoodleBaseURL = ""
+			c.LoginURL, c.CoursesURL = "https://m.example/login/index.php", "https://m.example/grade/report/overview/index.php"
+			c.AttendanceListURL, c.AttendanceURL = "https://m.example/mod/attendance/index.php", "https://m.example/mod/attendance/view.php"
+			c.AttendanceFormURL = "https://m.example/mod/attendance/attendance.php"
+		}},
+		{name: "unknown site", edit: func(c *Config) { c.MoodleSite = "blackboard" }, want: "MOODLE_SITE"},
+		{name: "unknown profile", edit: func(c *Config) { c.MoodleProfile = "fr" }, want: "MOODLE_PROFILE"},
+		{name: "probe max below min", edit: func(c *Config) { c.BreakerProbeMaxSec = 60 }, want: "BREAKER_PROBE_MAX_SEC"},
+		{name: "digest period", edit: func(c *Config) { c.DigestPeriod = "month" }, want: "DIGEST_PERIOD"},
+		{name: "relative webhook", edit: func(c *Config) { c.SlackWebhookURL = "/services/T0KEN" }, want: "SLACK_WEBHOOK_URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaults()
+			cfg.MoodleBaseURL = "https://moodle.example.ac.id"
+			tt.edit(&cfg)
+			err := cfg.Validate()
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("Validate = %v, want no problem", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("Validate = %v, want a %s problem", err, tt.want)
+			}
+		})
+	}
+}
+
+// required is the smallest environment Load accepts.
+var required = map[string]string{
+	"TIMEZONE": "Asia/Makassar", "USERNAME": "jane", "PASSWORD": "hunter2",
+	"WA_ENDPOINT": "https://wa.example.com/send", "WA_TOKEN": "t0ken",
+	"MOODLE_BASE_URL": "https://moodle.example.ac.id",
+}
+
+func TestFileUnderEnv(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": "wa_me: from-file\nwebhook_url: https://hooks.example.com/T0KEN\nconcurrency: 8\nchatops_allow:\n  - \"628111\"\n  - \"628222\"\nrate_endpoints:\n  submit: 0.2\n",
+		"config.toml": "WA_ME = \"from-file\"\nWEBHOOK_URL = \"https://hooks.example.com/T0KEN\"\nCONCURRENCY = 8\nCHATOPS_ALLOW = [\"628111\", \"628222\"]\n[RATE_ENDPOINTS]\nsubmit = 0.2\n",
+	}
+	for name, body := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range required {
+				t.Setenv(k, v)
+			}
+			t.Setenv("CONFIG_FILE", path)
+			t.Setenv("CONCURRENCY", "2") // the env wins over the file
+
+			cfg, err := Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.WAMe != "from-file" || cfg.Concurrency != 2 {
+				t.Errorf("WA_ME %q, CONCURRENCY %d; want from-file and the env's 2", cfg.WAMe, cfg.Concurrency)
+			}
+			if len(cfg.ChatOpsAllow) != 2 || cfg.RateEndpoints["submit"] != 0.2 {
+				t.Errorf("CHATOPS_ALLOW %v, RATE_ENDPOINTS %v", cfg.ChatOpsAllow, cfg.RateEndpoints)
+			}
+
+			settings, err := Explain()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]Setting{}
+			for _, s := range settings {
+				got[s.Key] = s
+			}
+			for key, want := range map[string]Setting{
+				"WA_ME":       {Value: "from-file", Source: "file"},
+				"CONCURRENCY": {Value: "2", Source: "env"},
+				"WEBHOOK_URL": {Value: "****", Source: "file"},
+				"PASSWORD":    {Value: "****", Source: "env"},
+				"LOG_LEVEL":   {Value: "info", Source: "default"},
+			} {
+				if s := got[key]; s.Value != want.Value || s.Source != want.Source {
+					t.Errorf("%s = %q from %s, want %q from %s", key, s.Value, s.Source, want.Value, want.Source)
+				}
+			}
+		})
+	}
+}
+
+func TestFileRejectsUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("lgoin_url: https://moodle.example.ac.id/login/index.php\nusername: jane\nconfig_file: other.yaml\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := readFile(path)
+	if err == nil || !strings.Contains(err.Error(), "config_file, lgoin_url") {
+		t.Errorf("readFile = %v, want lgoin_url and config_file rejected", err)
+	}
+	if err != nil && strings.Contains(err.Error(), "username") {
+		t.Errorf("readFile rejected a known key: %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Setting is one effective config value and where it came from.
+type Setting struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"` // default, file, vault, secret file or env
+}
+
+// Explain loads the config like Load and describes every setting, with
+// secrets masked. The returned error is the same one Load would return.
+func Explain() ([]Setting, error) {
+	cfg, src, err := load()
+	if src == nil {
+		return nil, err
+	}
+	v := reflect.ValueOf(cfg)
+	var out []Setting
+	for _, f := range fields() {
+		s := Setting{Key: f.Key, Value: format(v.Field(f.Index)), Source: "default"}
+		if from, ok := src[f.Key]; ok {
+			s.Source = from
+		}
+		if f.Secret && s.Value != "" {
+			s.Value = "****"
+		}
+		out = append(out, s)
+	}
+	return out, err
+}
+
+func format(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Slice:
+		parts := make([]string, v.Len())
+		for i := range parts {
+			parts[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return strings.Join(parts, ",")
+	case reflect.Map:
+		parts := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			parts = append(parts, fmt.Sprintf("%v:%v", k.Interface(), v.MapIndex(k).Interface()))
+		}
+		sort.Strings(parts)
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
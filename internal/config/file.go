@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// field is one env-tagged Config field.
+type field struct {
+	Key    string // env var name
+	Secret bool
+	Index  int
+}
+
+func fields() []field {
+	t := reflect.TypeOf(Config{})
+	out := make([]field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key, _, _ := strings.Cut(f.Tag.Get("env"), ",")
+		if key == "" {
+			continue
+		}
+		out = append(out, field{Key: key, Secret: f.Tag.Get("secret") == "true", Index: i})
+	}
+	return out
+}
+
+// known accepts every field key and KEY_FILE for secrets.
+func known(key string) bool {
+	for _, f := range fields() {
+		if f.Key == key || f.Secret && f.Key+"_FILE" == key {
+			return true
+		}
+	}
+	return false
+}
+
+// readFile flattens a YAML or TOML file into env-style values. Keys are the
+// env var names in any case ("login_url" or "LOGIN_URL"); lists become
+// "a,b" and maps "k:v,k2:v2", the same syntax the env vars use.
+func readFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config file: %w", err)
+	}
+	raw := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &raw)
+	case ".toml":
+		err = toml.Unmarshal(b, &raw)
+	default:
+		return nil, fmt.Errorf("config file %s: want .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	out := make(map[string]string, len(raw))
+	var unknown []string
+	for k, v := range raw {
+		key := strings.ToUpper(strings.ReplaceAll(k, "-", "_"))
+		if !known(key) || key == "CONFIG_FILE" {
+			unknown = append(unknown, k)
+			continue
+		}
+		out[key] = flatten(v)
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("config file %s: unknown keys %s", path, strings.Join(unknown, ", "))
+	}
+	return out, nil
+}
+
+func flatten(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []any:
+		parts := make([]string, len(v))
+		for i, e := range v {
+			parts[i] = flatten(e)
+		}
+		return strings.Join(parts, ",")
+	case map[string]any:
+		parts := make([]string, 0, len(v))
+		for k, e := range v {
+			parts = append(parts, k+":"+flatten(e))
+		}
+		sort.Strings(parts)
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
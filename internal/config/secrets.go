@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/emandor/gostudentubl/internal/secrets"
+)
+
+// secret reports whether key is a field tagged secret.
+func secret(key string) bool {
+	for _, f := range fields() {
+		if f.Key == key {
+			return f.Secret
+		}
+	}
+	return false
+}
+
+// SecretKeys lists the settings that may be given as KEY_FILE or stored in the vault.
+func SecretKeys() []string {
+	var out []string
+	for _, f := range fields() {
+		if f.Secret && f.Key != "VAULT_PASSPHRASE" {
+			out = append(out, f.Key)
+		}
+	}
+	return out
+}
+
+// secretFiles replaces KEY_FILE with the file's content as KEY, for
+// Docker secrets and systemd credentials. Setting both in the same layer
+// is an error.
+func secretFiles(vars, src map[string]string) error {
+	for _, f := range fields() {
+		if !f.Secret {
+			continue
+		}
+		path := vars[f.Key+"_FILE"]
+		if path == "" {
+			continue
+		}
+		if vars[f.Key] != "" {
+			switch {
+			case src[f.Key] == src[f.Key+"_FILE"]:
+				return fmt.Errorf("set either %s or %s_FILE, not both", f.Key, f.Key)
+			case src[f.Key] == "env":
+				continue // the env beats a KEY_FILE from the config file
+			}
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("%s_FILE: %w", f.Key, err)
+		}
+		vars[f.Key], src[f.Key] = strings.TrimRight(string(b), "\r\n"), "secret file"
+	}
+	return nil
+}
+
+// applyVault lays the vault's secrets over the config file; values from
+// the environment or a KEY_FILE still win.
+func applyVault(vars, src map[string]string) error {
+	v, err := openVault(vars)
+	if v == nil || err != nil {
+		return err
+	}
+	for _, name := range v.Names() {
+		if !secret(name) || name == "VAULT_PASSPHRASE" || src[name] == "env" || src[name] == "secret file" {
+			continue
+		}
+		vars[name], _ = v.Get(name)
+		src[name] = "vault"
+	}
+	return nil
+}
+
+func openVault(vars map[string]string) (*secrets.Vault, error) {
+	if vars["VAULT_FILE"] == "" {
+		return nil, nil
+	}
+	v, err := secrets.Open(vars["VAULT_FILE"], vars["VAULT_PASSPHRASE"])
+	if err != nil {
+		return nil, fmt.Errorf("VAULT_FILE: %w", err)
+	}
+	return v, nil
+}
+
+// OpenVault opens VAULT_FILE without loading the rest of the config, so
+// secrets can be stored before the config is complete. It returns nil
+// when no vault is configured.
+func OpenVault() (*secrets.Vault, error) {
+	vars, _, err := layers()
+	if err != nil {
+		return nil, err
+	}
+	return openVault(vars)
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/emandor/gostudentubl/internal/moodle"
+)
+
+// Validate checks the values env parsing cannot: cron specs, URLs, the time
+// zone and numeric bounds. Empty required fields are already reported by
+// the parser, so they are skipped here.
+func (c Config) Validate() error {
+	var errs []error
+	add := func(key string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+
+	if c.Timezone != "" {
+		_, err := time.LoadLocation(c.Timezone)
+		add("TIMEZONE", err)
+	}
+
+	moodleURLs := []struct{ key, val string }{
+		{"LOGIN_URL", c.LoginURL},
+		{"COURSES_URL", c.CoursesURL},
+		{"ATTENDANCE_LIST_URL", c.AttendanceListURL},
+		{"ATTENDANCE_URL", c.AttendanceURL},
+		{"ATTENDANCE_FORM_URL", c.AttendanceFormURL},
+	}
+	if c.MoodleBaseURL == "" {
+		for _, u := range moodleURLs {
+			if u.val == "" {
+				add(u.key, errors.New("required when MOODLE_BASE_URL is not set"))
+			}
+		}
+	} else if _, err := c.Endpoints(); err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, u := range append(moodleURLs, []struct{ key, val string }{
+		{"LOGOUT_URL", c.LogoutURL},
+		{"WA_ENDPOINT", c.WAEndpoint},
+		{"DISCORD_WEBHOOK_URL", c.DiscordWebhookURL},
+		{"SLACK_WEBHOOK_URL", c.SlackWebhookURL},
+		{"WEBHOOK_URL", c.WebhookURL},
+	}...) {
+		if u.val != "" {
+			add(u.key, checkURL(u.val))
+		}
+	}
+
+	for _, s := range []struct{ key, val string }{
+		{"CRON_WEEKDAY", c.CronWeekday},
+		{"CRON_WEEKEND", c.CronWeekend},
+		{"DIGEST_CRON", c.DigestCron},
+	} {
+		if s.val != "" {
+			_, err := cron.ParseStandard(s.val)
+			add(s.key, err)
+		}
+	}
+
+	if _, err := c.Profile(); err != nil {
+		add("MOODLE_PROFILE", err)
+	}
+
+	switch c.NotifyLocale {
+	case "id", "en":
+	default:
+		add("NOTIFY_LOCALE", fmt.Errorf("%q is not id or en", c.NotifyLocale))
+	}
+	switch c.LogLevel {
+	case "trace", "debug", "info", "warn", "error":
+	default:
+		add("LOG_LEVEL", fmt.Errorf("%q is not trace, debug, info, warn or error", c.LogLevel))
+	}
+	switch c.LogFormat {
+	case "json", "console":
+	default:
+		add("LOG_FORMAT", fmt.Errorf("%q is not json or console", c.LogFormat))
+	}
+
+	switch c.TraceExporter {
+	case "none", "otlp", "stdout":
+	default:
+		add("TRACE_EXPORTER", fmt.Errorf("%q is not none, otlp or stdout", c.TraceExporter))
+	}
+
+	switch c.DigestPeriod {
+	case "day", "week":
+	default:
+		add("DIGEST_PERIOD", fmt.Errorf("%q is not day or week", c.DigestPeriod))
+	}
+	if c.ChatOpsAddr != "" && (c.ChatOpsSecret == "" || len(c.ChatOpsAllow) == 0) {
+		add("CHATOPS_ADDR", errors.New("needs CHATOPS_SECRET and CHATOPS_ALLOW"))
+	}
+
+	add("CONCURRENCY", between(float64(c.Concurrency), 1, 32))
+	add("RATE_PER_SEC", between(c.RatePerSec, 0.01, 20))
+	add("RATE_BURST", between(float64(c.RateBurst), 1, 50))
+	for _, name := range slices.Sorted(maps.Keys(c.RateEndpoints)) {
+		perSec := c.RateEndpoints[name]
+		if !slices.Contains(moodle.EndpointNames, name) {
+			add("RATE_ENDPOINTS", fmt.Errorf("unknown endpoint %q, have %s", name, strings.Join(moodle.EndpointNames, ", ")))
+			continue
+		}
+		add("RATE_ENDPOINTS", between(perSec, 0.01, 20))
+	}
+	add("RUN_MAX_REQUESTS", between(float64(c.RunMaxRequests), 0, 100000))
+	add("REQUEST_TIMEOUT_SEC", between(float64(c.RequestTimeoutSec), 1, 300))
+	add("BREAKER_THRESHOLD", between(float64(c.BreakerThreshold), 0, 20))
+	add("BREAKER_PROBE_MIN_SEC", between(float64(c.BreakerProbeMinSec), 10, 86400))
+	add("BREAKER_PROBE_MAX_SEC", between(float64(c.BreakerProbeMaxSec), float64(c.BreakerProbeMinSec), 7*86400))
+	add("SNAPSHOT_KEEP", between(float64(c.SnapshotKeep), 0, 10000))
+	add("SNAPSHOT_MAX_AGE_DAYS", between(float64(c.SnapshotMaxAgeDays), 0, 3650))
+
+	return errors.Join(errs...)
+}
+
+// checkURL leaves the value out of its errors: webhook URLs carry tokens
+// and validation errors end up in logs.
+func checkURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return errors.New("not a valid URL")
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("not an absolute http(s) URL")
+	}
+	return nil
+}
+
+func between(v, lo, hi float64) error {
+	if v < lo || v > hi {
+		return fmt.Errorf("%v is outside %v..%v", v, lo, hi)
+	}
+	return nil
+}
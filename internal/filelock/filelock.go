@@ -0,0 +1,41 @@
+// Package filelock serialises writers of a state file across processes,
+// so the daemon and a one-off CLI command never interleave their updates
+// or their runs.
+package filelock
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Lock blocks until it holds an exclusive lock on path+".lock" and returns
+// the function that releases it. The lock file itself is left in place.
+func Lock(path string) (func(), error) {
+	unlock, _, err := take(path, true)
+	return unlock, err
+}
+
+// TryLock is Lock without the wait: ok is false when another process
+// holds the lock.
+func TryLock(path string) (unlock func(), ok bool, err error) {
+	return take(path, false)
+}
+
+func take(path string, wait bool) (func(), bool, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, false, err
+	}
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, false, err
+	}
+	ok, err := lock(f, wait)
+	if err != nil || !ok {
+		f.Close()
+		return nil, false, err
+	}
+	return func() {
+		unlock(f)
+		f.Close()
+	}, true, nil
+}
@@ -0,0 +1,176 @@
+// Package fingerprint tracks the structure of the Moodle pages the parsers
+// read, so a theme change shows up before a session is missed.
+package fingerprint
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fingerprint is how often each selector a parser relies on matched on one
+// page of type Page (courses, attendance_list, view or form).
+type Fingerprint struct {
+	Page   string         `json:"page"`
+	Counts map[string]int `json:"counts"`
+}
+
+// Baseline is the last good fingerprint of a page type.
+type Baseline struct {
+	Counts map[string]int `json:"counts"`
+	Since  time.Time      `json:"since"`
+	Seen   time.Time      `json:"seen"`
+}
+
+// Store keeps a baseline per page type in the JSON file at Path. The first
+// page of each type becomes its baseline; delete the file to start over,
+// e.g. after switching MOODLE_PROFILE on purpose.
+type Store struct {
+	Path string
+
+	mu     sync.Mutex
+	loaded bool
+	base   map[string]Baseline
+	latest map[string][]string // missing on the latest page per type
+	// run holds, per page type and selector, whether the selector was
+	// missing on every page since Begin that measured it
+	run map[string]map[string]bool
+}
+
+// Observe compares f with its baseline and returns the selectors that
+// matched there but not on this page. changed is true when that list
+// differs from the previous observation of the page type. Only selectors
+// measured on both pages count, so optional parts of a page can be left
+// out of f when they do not apply.
+func (s *Store) Observe(f Fingerprint) (missing []string, changed bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, false, err
+	}
+	now := time.Now()
+	b, ok := s.base[f.Page]
+	if !ok {
+		b = Baseline{Counts: map[string]int{}, Since: now}
+	}
+	for sel, n := range f.Counts {
+		if n == 0 && b.Counts[sel] > 0 {
+			missing = append(missing, sel)
+		}
+	}
+	sort.Strings(missing)
+	prev, seen := s.latest[f.Page]
+	changed = seen && !slices.Equal(prev, missing) || !seen && len(missing) > 0
+	s.latest[f.Page] = missing
+	agg := s.run[f.Page]
+	if agg == nil {
+		agg = map[string]bool{}
+		s.run[f.Page] = agg
+	}
+	for sel := range f.Counts {
+		if b.Counts[sel] == 0 {
+			continue
+		}
+		gone := slices.Contains(missing, sel)
+		if all, ok := agg[sel]; ok {
+			gone = gone && all
+		}
+		agg[sel] = gone
+	}
+
+	if len(missing) > 0 {
+		// keep the good baseline until the markup is back
+		return missing, changed, nil
+	}
+	for sel, n := range f.Counts {
+		if n > 0 {
+			b.Counts[sel] = n
+		}
+	}
+	b.Seen = now
+	s.base[f.Page] = b
+	return nil, changed, s.save()
+}
+
+// Begin starts a new run for Drift.
+func (s *Store) Begin() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.run = map[string]map[string]bool{}
+}
+
+// Drift returns, per page type observed since Begin, the selectors that
+// were missing on every page of that type. One odd page, like a course
+// without sessions yet, does not count as drift; an empty list means the
+// page type matches.
+func (s *Store) Drift() map[string][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string][]string, len(s.run))
+	for p, agg := range s.run {
+		missing := []string{}
+		for sel, gone := range agg {
+			if gone {
+				missing = append(missing, sel)
+			}
+		}
+		sort.Strings(missing)
+		out[p] = missing
+	}
+	return out
+}
+
+// Baselines returns a copy of the stored baselines.
+func (s *Store) Baselines() (map[string]Baseline, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	out := make(map[string]Baseline, len(s.base))
+	for p, b := range s.base {
+		out[p] = b
+	}
+	return out, nil
+}
+
+func (s *Store) load() error {
+	if s.loaded {
+		return nil
+	}
+	s.base, s.latest = map[string]Baseline{}, map[string][]string{}
+	if s.run == nil {
+		s.run = map[string]map[string]bool{}
+	}
+	b, err := os.ReadFile(s.Path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &s.base); err != nil {
+			return err
+		}
+	}
+	s.loaded = true
+	return nil
+}
+
+func (s *Store) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(s.base, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.Path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Path)
+}
@@ -0,0 +1,56 @@
+package fingerprint
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestDrift(t *testing.T) {
+	const rows, date = "table tr", "table tr td.datecol"
+	tests := []struct {
+		name  string
+		pages []map[string]int // view pages of one run, after the baseline
+		want  []string
+	}{
+		{name: "all match", pages: []map[string]int{{rows: 3, date: 2}, {rows: 1, date: 1}}, want: []string{}},
+		{name: "one odd page", pages: []map[string]int{{rows: 3, date: 0}, {rows: 2, date: 2}}, want: []string{}},
+		{name: "gone everywhere", pages: []map[string]int{{rows: 3, date: 0}, {rows: 2, date: 0}}, want: []string{date}},
+		{name: "unmeasured page does not vote", pages: []map[string]int{{rows: 3, date: 0}, {rows: 0}}, want: []string{date}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Store{Path: filepath.Join(t.TempDir(), "fingerprints.json")}
+			if _, _, err := s.Observe(Fingerprint{Page: "view", Counts: map[string]int{rows: 2, date: 2}}); err != nil {
+				t.Fatal(err)
+			}
+
+			s.Begin()
+			for _, counts := range tt.pages {
+				if _, _, err := s.Observe(Fingerprint{Page: "view", Counts: counts}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			drift := s.Drift()
+			if got := drift["view"]; !slices.Equal(got, tt.want) {
+				t.Errorf("drift = %q, want %q", got, tt.want)
+			}
+			if _, ok := drift["courses"]; ok {
+				t.Error("courses reported without being observed this run")
+			}
+		})
+	}
+}
+
+func TestBeginForgetsEarlierRuns(t *testing.T) {
+	s := &Store{Path: filepath.Join(t.TempDir(), "fingerprints.json")}
+	s.Observe(Fingerprint{Page: "form", Counts: map[string]int{"input": 5}})
+	s.Observe(Fingerprint{Page: "form", Counts: map[string]int{"input": 0}})
+	if got := s.Drift()["form"]; len(got) != 1 {
+		t.Fatalf("drift before Begin = %q, want input", got)
+	}
+	s.Begin()
+	if got := s.Drift(); len(got) != 0 {
+		t.Errorf("drift after Begin = %v, want nothing", got)
+	}
+}
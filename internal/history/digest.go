@@ -0,0 +1,101 @@
+package history
+
+import (
+	"sort"
+	"time"
+)
+
+type CourseStat struct {
+	CourseID int     `json:"courseId"`
+	Course   string  `json:"course"`
+	Earned   float64 `json:"earned"`
+	Max      float64 `json:"max"`
+	Taken    int     `json:"taken"`
+}
+
+// Percent is earned points over possible points for taken sessions.
+func (c CourseStat) Percent() float64 {
+	if c.Max == 0 {
+		return 0
+	}
+	return c.Earned / c.Max * 100
+}
+
+// Summary is what a digest reports for one window.
+type Summary struct {
+	Period    string       `json:"period"`
+	From      time.Time    `json:"from"`
+	To        time.Time    `json:"to"`
+	Submitted []Record     `json:"submitted"`
+	Failed    []Record     `json:"failed"`
+	Missing   []Session    `json:"missing"`  // taken in the window without points
+	Upcoming  []Session    `json:"upcoming"` // not taken yet, soonest first
+	Courses   []CourseStat `json:"courses"`
+}
+
+// Window returns the digest window ending at now: the current day or the last 7 days.
+func Window(period string, now time.Time) (time.Time, time.Time) {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if period == "week" {
+		return day.AddDate(0, 0, -6), day.AddDate(0, 0, 1)
+	}
+	return day, day.AddDate(0, 0, 1)
+}
+
+// Summarise builds the digest for period ("day" or "week") as of now.
+func (s *Store) Summarise(period string, now time.Time) (Summary, error) {
+	from, to := Window(period, now)
+	sum := Summary{Period: period, From: from, To: to}
+
+	recs, err := s.Records(from, to)
+	if err != nil {
+		return sum, err
+	}
+	for _, r := range recs {
+		switch r.Kind {
+		case KindSubmitted:
+			sum.Submitted = append(sum.Submitted, r)
+		case KindFailed:
+			sum.Failed = append(sum.Failed, r)
+		}
+	}
+
+	sessions, err := s.Sessions()
+	if err != nil {
+		return sum, err
+	}
+	stats := map[int]*CourseStat{}
+	for _, ss := range sessions {
+		if ss.Taken {
+			st, ok := stats[ss.CourseID]
+			if !ok {
+				st = &CourseStat{CourseID: ss.CourseID, Course: ss.Course}
+				stats[ss.CourseID] = st
+			}
+			st.Earned += ss.Earned
+			st.Max += ss.Max
+			st.Taken++
+			if ss.Max > 0 && ss.Earned == 0 && ss.At != nil && !ss.At.Before(from) && ss.At.Before(to) {
+				sum.Missing = append(sum.Missing, ss)
+			}
+			continue
+		}
+		// undated rows are kept, we cannot tell they are in the past; dated
+		// ones before now are closed, even inside the window
+		if ss.At == nil || !ss.At.Before(now) {
+			sum.Upcoming = append(sum.Upcoming, ss)
+		}
+	}
+	sort.SliceStable(sum.Upcoming, func(i, j int) bool {
+		a, b := sum.Upcoming[i].At, sum.Upcoming[j].At
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return a.Before(*b)
+	})
+	for _, st := range stats {
+		sum.Courses = append(sum.Courses, *st)
+	}
+	sort.Slice(sum.Courses, func(i, j int) bool { return sum.Courses[i].Course < sum.Courses[j].Course })
+	return sum, nil
+}
@@ -0,0 +1,43 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummariseUpcoming(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC) // a Wednesday
+	at := func(d time.Duration) *time.Time { t := now.Add(d); return &t }
+	tests := []struct {
+		name   string
+		period string
+		at     *time.Time
+		want   bool
+	}{
+		{name: "tomorrow", period: "week", at: at(24 * time.Hour), want: true},
+		{name: "later today", period: "day", at: at(2 * time.Hour), want: true},
+		{name: "earlier in the week", period: "week", at: at(-3 * 24 * time.Hour)},
+		{name: "earlier today", period: "day", at: at(-2 * time.Hour)},
+		{name: "before the window", period: "week", at: at(-30 * 24 * time.Hour)},
+		{name: "undated", period: "week", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Open(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			ss := Session{CourseID: 1, Course: "Basis Data", AttendanceID: "7", At: tt.at, Max: 2}
+			if err := s.PutSessions("7", []Session{ss}); err != nil {
+				t.Fatal(err)
+			}
+			sum, err := s.Summarise(tt.period, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(sum.Upcoming) == 1; got != tt.want {
+				t.Errorf("listed as upcoming = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type Kind string
+
+const (
+	KindSubmitted Kind = "submitted"
+	KindFailed    Kind = "failed"
+)
+
+// Record is one attendance outcome, appended to history.jsonl.
+type Record struct {
+	At           time.Time `json:"at"`
+	Kind         Kind      `json:"kind"`
+	CourseID     int       `json:"courseId"`
+	Course       string    `json:"course"`
+	AttendanceID string    `json:"attendanceId"`
+	Attendance   string    `json:"attendance"`
+	Link         string    `json:"link,omitempty"`
+	Detail       string    `json:"detail,omitempty"`
+}
+
+// Session is the last known state of one attendance session row.
+type Session struct {
+	CourseID     int        `json:"courseId"`
+	Course       string     `json:"course"`
+	AttendanceID string     `json:"attendanceId"`
+	Attendance   string     `json:"attendance"`
+	Link         string     `json:"link,omitempty"`
+	Date         string     `json:"date"`
+	At           *time.Time `json:"at,omitempty"`
+	Description  string     `json:"description,omitempty"`
+	Status       string     `json:"status,omitempty"`
+	Earned       float64    `json:"earned"`
+	Max          float64    `json:"max"`
+	Taken        bool       `json:"taken"`
+}
+
+// Store keeps run history under dir: an append-only history.jsonl and a
+// sessions.json snapshot keyed by attendance ID.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+func (s *Store) Append(recs ...Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(filepath.Join(s.dir, "history.jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, r := range recs {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Records returns every record with At in [from, to).
+func (s *Store) Records(from, to time.Time) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(filepath.Join(s.dir, "history.jsonl"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []Record
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		var r Record
+		if json.Unmarshal(sc.Bytes(), &r) != nil {
+			continue
+		}
+		if !r.At.Before(from) && r.At.Before(to) {
+			out = append(out, r)
+		}
+	}
+	return out, sc.Err()
+}
+
+// PutSessions replaces the stored sessions of one attendance.
+func (s *Store) PutSessions(attendanceID string, ss []Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all, err := s.loadSessions()
+	if err != nil {
+		return err
+	}
+	all[attendanceID] = ss
+	b, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	p := filepath.Join(s.dir, "sessions.json")
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// Sessions returns every stored session.
+func (s *Store) Sessions() ([]Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all, err := s.loadSessions()
+	if err != nil {
+		return nil, err
+	}
+	var out []Session
+	for _, ss := range all {
+		out = append(out, ss...)
+	}
+	return out, nil
+}
+
+func (s *Store) loadSessions() (map[string][]Session, error) {
+	all := map[string][]Session{}
+	b, err := os.ReadFile(filepath.Join(s.dir, "sessions.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return all, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return all, json.Unmarshal(b, &all)
+}
@@ -0,0 +1,65 @@
+package httpx
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/emandor/gostudentubl/internal/metrics"
+	"github.com/emandor/gostudentubl/internal/telemetry"
+)
+
+type endpointKey struct{}
+
+// WithEndpoint names the Moodle endpoint a request is for (login, courses,
+// attendance_list, view, form, submit...), used as a metrics label.
+func WithEndpoint(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, endpointKey{}, name)
+}
+
+// Endpoint returns the name set by WithEndpoint, or "other".
+func Endpoint(ctx context.Context) string {
+	if name, ok := ctx.Value(endpointKey{}).(string); ok {
+		return name
+	}
+	return "other"
+}
+
+// instrumented records a span, latency and status of every attempt, so
+// retries show up as separate observations. The span carries the URL
+// without its query, which may hold a sesskey.
+type instrumented struct {
+	next http.RoundTripper
+}
+
+func (t instrumented) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := Endpoint(req.Context())
+	ctx, span := telemetry.Tracer().Start(req.Context(), "moodle "+endpoint,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.path", req.URL.Path),
+			attribute.String("server.address", req.URL.Host),
+			attribute.String("moodle.endpoint", endpoint),
+		))
+	defer span.End()
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		if resp.StatusCode >= 500 {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+	}
+	telemetry.Fail(span, err)
+	metrics.HTTPDuration.WithLabelValues(endpoint, code).Observe(time.Since(start).Seconds())
+	return resp, err
+}
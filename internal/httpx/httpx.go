@@ -1,16 +1,28 @@
 package httpx
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
+	"io"
 	"net"
 	"net/http"
 	"net/http/cookiejar"
 	"time"
 
 	retry "github.com/hashicorp/go-retryablehttp"
+
+	"github.com/emandor/gostudentubl/internal/metrics"
 )
 
-func NewHTTP(timeout time.Duration) (*http.Client, error) {
+// NewHTTP builds the Moodle client: limits and budget (see Limits), then
+// retries (see checkRetry), then instrumentation of each attempt. timeout
+// bounds every exchange, redirect hops each on their own, so waiting for
+// the limiter before a hop does not eat into it. lim may be nil.
+func NewHTTP(timeout time.Duration, lim *Limits) (*http.Client, error) {
+	if lim == nil {
+		lim = &Limits{}
+	}
 	jar, _ := cookiejar.New(nil)
 
 	transport := &http.Transport{
@@ -23,10 +35,80 @@ func NewHTTP(timeout time.Duration) (*http.Client, error) {
 	}
 
 	rc := retry.NewClient()
+	// The default logger prints every URL, sesskey included, to stderr
+	// past the redacting log writer; attempts are traced and counted instead.
+	rc.Logger = nil
 	rc.RetryMax = 3
 	rc.RetryWaitMin = 500 * time.Millisecond
 	rc.RetryWaitMax = 2 * time.Second
-	rc.HTTPClient = &http.Client{Timeout: timeout, Transport: transport, Jar: jar}
+	rc.HTTPClient = &http.Client{
+		Transport: perHop{next: instrumented{transport}, timeout: timeout},
+		Jar:       jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return lim.admit(req)
+		},
+	}
+	rc.CheckRetry = checkRetry
+	rc.ErrorHandler = giveUp
+	rc.PrepareRetry = lim.admit
+	rc.RequestLogHook = func(_ retry.Logger, req *http.Request, attempt int) {
+		if attempt > 0 {
+			metrics.HTTPRetries.WithLabelValues(Endpoint(req.Context())).Inc()
+		}
+	}
+
+	return &http.Client{Transport: methodAware{limited{next: &retry.RoundTripper{Client: rc}, limits: lim}}}, nil
+}
+
+// Jar returns the cookie jar of a client from NewHTTP; the retrying
+// transport keeps it on the inner client.
+func Jar(hc *http.Client) http.CookieJar {
+	t := hc.Transport
+	if ma, ok := t.(methodAware); ok {
+		t = ma.next
+	}
+	if l, ok := t.(limited); ok {
+		t = l.next
+	}
+	if rt, ok := t.(*retry.RoundTripper); ok && rt.Client != nil && rt.Client.HTTPClient != nil {
+		return rt.Client.HTTPClient.Jar
+	}
+	return hc.Jar
+}
+
+// perHop applies the request timeout to one exchange, body included. It
+// stands in for http.Client.Timeout, which would also cover CheckRedirect
+// and so the limiter waits between hops.
+type perHop struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t perHop) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.timeout <= 0 {
+		return t.next.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody releases the timeout of a perHop exchange once read.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
 
-	return rc.StandardClient(), nil
+func (b cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
 }
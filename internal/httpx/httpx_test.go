@@ -0,0 +1,43 @@
+package httpx
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// TestNothingReachesStderr runs a request in a child process, since the
+// retry client's default logger holds on to the original stderr.
+func TestNothingReachesStderr(t *testing.T) {
+	if os.Getenv("HTTPX_STDERR_CHILD") == "1" {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer srv.Close()
+		hc, err := NewHTTP(5*time.Second, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := hc.Get(srv.URL + "/mod/attendance/attendance.php?sesskey=s3cr3t")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestNothingReachesStderr$")
+	cmd.Env = append(os.Environ(), "HTTPX_STDERR_CHILD=1")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("child: %v\n%s", err, stderr.String())
+	}
+	if stderr.Len() > 0 {
+		t.Errorf("stderr = %q; want nothing", stderr.String())
+	}
+}
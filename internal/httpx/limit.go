@@ -0,0 +1,108 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/time/rate"
+
+	"github.com/emandor/gostudentubl/internal/metrics"
+	"github.com/emandor/gostudentubl/internal/telemetry"
+)
+
+// ErrBudget is returned for requests past the cap set by WithBudget.
+var ErrBudget = errors.New("request budget exhausted")
+
+// Limits throttles every attempt the client makes, retries and redirect
+// hops included.
+// Global applies to all requests, Endpoints additionally to the named
+// ones (see WithEndpoint). Nil limiters do not throttle.
+type Limits struct {
+	Global    *rate.Limiter
+	Endpoints map[string]*rate.Limiter
+	// Log is the fallback when the context carries no logger.
+	Log zerolog.Logger
+}
+
+// budget counts the requests of one run, see WithBudget.
+type budget struct {
+	max       int64
+	used      atomic.Int64
+	waited    atomic.Int64 // nanoseconds spent in the limiters
+	exhausted atomic.Bool
+}
+
+type budgetKey struct{}
+
+// WithBudget caps the requests made with ctx at max, after which they
+// fail with ErrBudget. Zero or less only counts them, see Usage.
+func WithBudget(ctx context.Context, max int) context.Context {
+	return context.WithValue(ctx, budgetKey{}, &budget{max: int64(max)})
+}
+
+// Usage returns the requests made under the budget in ctx and the time
+// they spent waiting on the limiters.
+func Usage(ctx context.Context) (requests int, waited time.Duration, ok bool) {
+	b, ok := ctx.Value(budgetKey{}).(*budget)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(b.used.Load()), time.Duration(b.waited.Load()), true
+}
+
+// limited applies Limits to the first attempt of a request; retries go
+// through admit via the retry client's PrepareRetry and redirect hops via
+// CheckRedirect. All sit outside the per-hop timeout, so queueing behind
+// the limiter never times out.
+type limited struct {
+	next   http.RoundTripper
+	limits *Limits
+}
+
+func (t limited) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limits.admit(req); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+// admit charges req to the run budget and waits for the limiters.
+func (l *Limits) admit(req *http.Request) error {
+	ctx := req.Context()
+	log := telemetry.Ctx(ctx, l.Log)
+	endpoint := Endpoint(ctx)
+
+	b, _ := ctx.Value(budgetKey{}).(*budget)
+	if b != nil {
+		if n := b.used.Add(1); b.max > 0 && n > b.max {
+			b.used.Add(-1) // only count what was sent
+			if b.exhausted.CompareAndSwap(false, true) {
+				log.Warn().Int64("budget", b.max).Str("endpoint", endpoint).Msg("🪫 request budget exhausted, refusing further requests this run")
+			}
+			return fmt.Errorf("%w (%d requests)", ErrBudget, b.max)
+		}
+	}
+
+	start := time.Now()
+	for _, rl := range []*rate.Limiter{l.Global, l.Endpoints[endpoint]} {
+		if rl == nil {
+			continue
+		}
+		if err := rl.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if waited := time.Since(start); waited > time.Millisecond {
+		metrics.LimiterWait.Observe(waited.Seconds())
+		if b != nil {
+			b.waited.Add(int64(waited))
+		}
+		log.Debug().Str("endpoint", endpoint).Dur("wait", waited).Msg("rate limited")
+	}
+	return nil
+}
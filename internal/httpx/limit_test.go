@@ -0,0 +1,86 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// redirects sends /n to /n-1 until /0, which answers 200.
+func redirects(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Path[1:])
+		if n > 0 {
+			http.Redirect(w, r, "/"+strconv.Itoa(n-1), http.StatusFound)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRedirectsCountAgainstBudget(t *testing.T) {
+	srv := redirects(t)
+	tests := []struct {
+		name    string
+		hops    int
+		budget  int
+		used    int
+		wantErr error
+	}{
+		{name: "no redirect", hops: 0, budget: 5, used: 1},
+		{name: "every hop counted", hops: 3, budget: 5, used: 4},
+		{name: "hops past the budget refused", hops: 3, budget: 2, used: 2, wantErr: ErrBudget},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hc, err := NewHTTP(5*time.Second, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := WithBudget(context.Background(), tt.budget)
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/"+strconv.Itoa(tt.hops), nil)
+			resp, err := hc.Do(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Do = %v, want %v", err, tt.wantErr)
+			}
+			if used, _, _ := Usage(ctx); used != tt.used {
+				t.Errorf("used %d requests, want %d", used, tt.used)
+			}
+		})
+	}
+}
+
+func TestLimiterWaitBetweenHopsIsNotTimedOut(t *testing.T) {
+	srv := redirects(t)
+	// one request per 150ms: three hops wait longer than the 200ms timeout
+	lim := &Limits{Global: rate.NewLimiter(rate.Every(150*time.Millisecond), 1)}
+	hc, err := NewHTTP(200*time.Millisecond, lim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithBudget(context.Background(), 0)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/3", nil)
+	resp, err := hc.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if b, _ := io.ReadAll(resp.Body); string(b) != "ok" {
+		t.Errorf("body %q", b)
+	}
+	if _, waited, _ := Usage(ctx); waited < 300*time.Millisecond {
+		t.Errorf("waited %s on the limiter, want the redirects throttled", waited)
+	}
+}
@@ -0,0 +1,68 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// StatusError is a response the retries could not get past, e.g. a 503
+// during maintenance or a 429 asking to come back later.
+type StatusError struct {
+	Code       int
+	Attempts   int
+	RetryAfter time.Duration // from the last response, if it said
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("giving up after %d attempt(s): %d %s", e.Attempts, e.Code, http.StatusText(e.Code))
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(", retry after %s", e.RetryAfter)
+	}
+	return msg
+}
+
+// giveUp replaces retryablehttp's untyped error once the retries are used up.
+// A budget or context error wins over the response, which for a refused
+// redirect hop is only the 3xx before it.
+func giveUp(resp *http.Response, err error, attempts int) (*http.Response, error) {
+	stopped := errors.Is(err, ErrBudget) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+	if resp != nil && stopped {
+		resp.Body.Close()
+	}
+	if resp != nil && !stopped {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		se := &StatusError{Code: resp.StatusCode, Attempts: attempts}
+		se.RetryAfter, _ = retryAfter(resp)
+		return nil, se
+	}
+	return nil, fmt.Errorf("giving up after %d attempt(s): %w", attempts, err)
+}
+
+// IsOutage reports whether err looks like the site or the network being
+// down rather than Moodle answering: server errors the retries could not
+// get past, timeouts, refused connections and DNS failures.
+func IsOutage(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code >= 500
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	var oe *net.OpError
+	var de *net.DNSError
+	return errors.As(err, &oe) || errors.As(err, &de)
+}
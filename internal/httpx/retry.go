@@ -0,0 +1,96 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	retry "github.com/hashicorp/go-retryablehttp"
+)
+
+// maxRetryAfter is the longest Retry-After worth waiting for inside a run;
+// anything longer gives up with a StatusError carrying the delay.
+const maxRetryAfter = 30 * time.Second
+
+type (
+	methodKey      struct{}
+	noRetryKey     struct{}
+	retryUnsafeKey struct{}
+)
+
+// WithoutRetry makes requests with ctx a single attempt whose response is
+// returned whatever its status, e.g. for a probe.
+func WithoutRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRetryKey{}, true)
+}
+
+// RetryUnsafe lets a POST with ctx be retried like a GET. Only use it once
+// the caller has checked that an earlier attempt did not take effect,
+// e.g. that the attendance is still not recorded.
+func RetryUnsafe(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryUnsafeKey{}, true)
+}
+
+// methodAware puts the request method in the context, CheckRetry only
+// sees the context when there is no response.
+type methodAware struct {
+	next http.RoundTripper
+}
+
+func (t methodAware) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.next.RoundTrip(req.WithContext(context.WithValue(req.Context(), methodKey{}, req.Method)))
+}
+
+func idempotent(ctx context.Context) bool {
+	switch m, _ := ctx.Value(methodKey{}).(string); m {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, "":
+		return true
+	}
+	return false
+}
+
+// checkRetry retries GETs on network errors, 5xx and 429 like the default
+// policy. POSTs (login, logout, submit) are sent once unless RetryUnsafe
+// says otherwise, so a submission is never duplicated and a login token
+// never reused. The wait between attempts honours Retry-After (see
+// retry.DefaultBackoff) up to maxRetryAfter.
+func checkRetry(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+	if off, _ := ctx.Value(noRetryKey{}).(bool); off {
+		return false, nil
+	}
+	if errors.Is(err, ErrBudget) {
+		// a redirect hop was refused, a retry would be too
+		return false, err
+	}
+	if unsafe, _ := ctx.Value(retryUnsafeKey{}).(bool); !idempotent(ctx) && !unsafe {
+		return false, nil
+	}
+	if d, ok := retryAfter(resp); ok && d > maxRetryAfter {
+		return false, fmt.Errorf("Retry-After %s is too long to wait", d)
+	}
+	return retry.DefaultRetryPolicy(ctx, resp, err)
+}
+
+// retryAfter reads the Retry-After of a 429 or 503.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(v); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
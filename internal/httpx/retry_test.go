@@ -0,0 +1,59 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestCheckRetry(t *testing.T) {
+	status := func(code int, retryAfter string) *http.Response {
+		res := &http.Response{StatusCode: code, Header: http.Header{}}
+		if retryAfter != "" {
+			res.Header.Set("Retry-After", retryAfter)
+		}
+		return res
+	}
+	netErr := errors.New("connection reset by peer")
+	tests := []struct {
+		name    string
+		method  string
+		unsafe  bool
+		resp    *http.Response
+		err     error
+		want    bool
+		wantErr bool
+	}{
+		{name: "GET 200", method: http.MethodGet, resp: status(200, "")},
+		{name: "GET 502", method: http.MethodGet, resp: status(502, ""), want: true},
+		{name: "GET network error", method: http.MethodGet, err: netErr, want: true},
+		{name: "GET 404", method: http.MethodGet, resp: status(404, "")},
+		{name: "GET 429 short Retry-After", method: http.MethodGet, resp: status(429, "5"), want: true},
+		{name: "GET 503 Retry-After over the cap", method: http.MethodGet, resp: status(503, "120"), wantErr: true},
+		{name: "POST 502", method: http.MethodPost, resp: status(502, "")},
+		{name: "POST network error", method: http.MethodPost, err: netErr},
+		{name: "POST 502 RetryUnsafe", method: http.MethodPost, unsafe: true, resp: status(502, ""), want: true},
+		{name: "POST network error RetryUnsafe", method: http.MethodPost, unsafe: true, err: netErr, want: true},
+		{name: "POST 429 RetryUnsafe over the cap", method: http.MethodPost, unsafe: true, resp: status(429, "3600"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), methodKey{}, tt.method)
+			if tt.unsafe {
+				ctx = RetryUnsafe(ctx)
+			}
+			got, err := checkRetry(ctx, tt.resp, tt.err)
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("checkRetry = %v, %v; want %v, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckRetryWithoutRetry(t *testing.T) {
+	ctx := WithoutRetry(context.WithValue(context.Background(), methodKey{}, http.MethodGet))
+	if got, err := checkRetry(ctx, &http.Response{StatusCode: 502}, nil); got || err != nil {
+		t.Errorf("checkRetry = %v, %v; want a single attempt", got, err)
+	}
+}
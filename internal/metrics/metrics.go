@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gostudentubl"
+
+// Registry holds every collector below plus the Go and process ones.
+var Registry = prometheus.NewRegistry()
+
+var (
+	Runs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "runs_total",
+		Help: "Attendance runs by outcome (ok, partial, error, skipped).",
+	}, []string{"outcome"})
+	RunDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Name: "run_duration_seconds",
+		Help:    "Duration of attendance runs by outcome.",
+		Buckets: []float64{1, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"outcome"})
+	Attendance = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "attendance_total",
+		Help: "Attendance submissions per course by result (submitted, failed).",
+	}, []string{"course", "result"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Name: "moodle_request_duration_seconds",
+		Help:    "Moodle HTTP request latency per attempt by endpoint and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"endpoint", "code"})
+	HTTPRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "moodle_request_retries_total",
+		Help: "Retried Moodle HTTP attempts by endpoint.",
+	}, []string{"endpoint"})
+	LimiterWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace, Name: "limiter_wait_seconds",
+		Help:    "Time spent waiting on the request rate limiter.",
+		Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1, 2, 5, 10},
+	})
+
+	BreakerOpen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace, Name: "breaker_open",
+		Help: "1 while runs are skipped because Moodle is down or in maintenance.",
+	})
+
+	Notifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Name: "notifications_total",
+		Help: "Notification deliveries by backend and result (ok, error).",
+	}, []string{"backend", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Runs, RunDuration, Attendance,
+		HTTPDuration, HTTPRetries, LimiterWait, BreakerOpen,
+		Notifications,
+	)
+}
+
+// Handler serves the registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Result maps an error to the "ok"/"error" label value.
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
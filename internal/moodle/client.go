@@ -4,88 +4,194 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/rs/zerolog"
+
+	"github.com/emandor/gostudentubl/internal/fingerprint"
+	"github.com/emandor/gostudentubl/internal/httpx"
+	"github.com/emandor/gostudentubl/internal/snapshot"
+	"github.com/emandor/gostudentubl/internal/telemetry"
 )
 
 type Client struct {
-	HC   *http.Client
+	HC *http.Client
+	// Log is the fallback when the context carries no logger, see telemetry.Ctx.
 	Log  zerolog.Logger
-	Base struct {
-		LoginURL          string
-		CoursesURL        string
-		AttendanceListURL string
-		AttendanceURL     string
-		AttendanceFormURL string
-	}
-	UA string
+	Base Endpoints
+	UA   string
+	Loc  *time.Location // zone session dates are shown in
+	// Profile holds selectors and labels for the site's theme and
+	// language; nil means Profiles["en"].
+	Profile *Profile
+	// Jar is the cookie jar HC uses, for persisting the session.
+	Jar http.CookieJar
+	// Snapshots keeps pages the parsers could not read; nil disables it.
+	Snapshots *snapshot.Store
+	// Identity is the name the user menu must show after login, to catch
+	// a login that ended up in another account; empty skips the check.
+	Identity string
+	// Reauth logs in again when a GET finds the session expired, after
+	// which the GET is replayed once; nil makes it ErrSessionExpired.
+	Reauth func(ctx context.Context) error
+	// Fingerprints compares each parsed page with a structural baseline;
+	// nil disables it.
+	Fingerprints *fingerprint.Store
+
+	reauthMu   sync.Mutex
+	sessionGen atomic.Uint64 // bumped by every re-login, see reauth
+}
+
+type ViewInfo struct {
+	SessionID, SessKey, SubmitLink string
+	// Sessions is the session log on the page, filled even when nothing is open.
+	Sessions []Session
+}
+
+// Session is one row of the student's session log.
+type Session struct {
+	Date        string
+	At          time.Time // zero when Date could not be parsed
+	Description string
+	Status      string
+	Earned, Max float64
+	Taken       bool
+	// SessID is set while the row links to the submit form.
+	SessID string
+	// SelfRecorded is true once the row says the student marked it.
+	SelfRecorded bool
 }
 
-type ViewInfo struct{ SessionID, SessKey, SubmitLink string }
+// Session returns the row of the session log whose submit link has sessID.
+func (vi ViewInfo) Session(sessID string) (Session, bool) {
+	for _, s := range vi.Sessions {
+		if sessID != "" && s.SessID == sessID {
+			return s, true
+		}
+	}
+	return Session{}, false
+}
 
 func (c *Client) ViewAttendanceByID(ctx context.Context, attendanceID string) (ViewInfo, error) {
 	u := fmt.Sprintf("%s?id=%s", c.Base.AttendanceURL, attendanceID)
-	doc, _, err := c.get(ctx, u)
+	doc, res, err := c.get(ctx, "view", u)
 	if err != nil {
 		return ViewInfo{}, err
 	}
-	return parseViewInfo(doc)
+	c.observe(ctx, "view", res, doc)
+	vi, err := parseViewInfo(doc, c.profile())
+	vi.Sessions = parseSessions(doc, c.Loc, c.profile())
+	// without an open session there is no submit link, that alone is normal;
+	// no session log either means the page is not what the parsers expect
+	if err != nil && len(vi.Sessions) == 0 {
+		c.snapshot(ctx, "view", res, doc, err.Error())
+	}
+	return vi, err
 }
 
-func (c *Client) get(ctx context.Context, u string) (*goquery.Document, *http.Response, error) {
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
-	req.Header.Set("User-Agent", c.UA)
-	res, err := c.HC.Do(req)
+// snapshot stores the page behind res for later diagnosis, see Snapshots.
+func (c *Client) snapshot(ctx context.Context, endpoint string, res *http.Response, doc *goquery.Document, reason string) {
+	if c.Snapshots == nil || doc == nil {
+		return
+	}
+	m := snapshot.Meta{Endpoint: endpoint, Reason: reason, RunID: telemetry.RunID(ctx)}
+	if res != nil {
+		m.Status = res.StatusCode
+		if res.Request != nil {
+			m.URL = res.Request.URL.String()
+		}
+	}
+	log := telemetry.Ctx(ctx, c.Log)
+	html, err := doc.Html()
+	if err == nil {
+		m, err = c.Snapshots.Save(m, []byte(html))
+	}
 	if err != nil {
-		return nil, nil, err
+		log.Warn().Err(err).Str("endpoint", endpoint).Msg("saving page snapshot")
+		return
 	}
-	defer func() { /* no body close here, goquery will */ }()
-	doc, err := goquery.NewDocumentFromReader(res.Body)
-	return doc, res, err
+	log.Warn().Str("snapshot", m.ID).Str("reason", reason).Msg("📸 page snapshot saved")
 }
 
-func (c *Client) postForm(ctx context.Context, u string, data url.Values) (*goquery.Document, *http.Response, error) {
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(data.Encode()))
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("User-Agent", c.UA)
-	res, err := c.HC.Do(req)
+func (c *Client) profile() Profile {
+	if c.Profile == nil {
+		return Profiles["en"]
+	}
+	return *c.Profile
+}
+
+// EndpointNames are the names requests are tagged with, see httpx.WithEndpoint.
+var EndpointNames = []string{"login", "logout", "courses", "attendance_list", "view", "form", "submit", "probe"}
+
+// get and postForm take the endpoint name for metrics and rate limits,
+// see httpx.WithEndpoint.
+// A GET that lands on the login page is replayed once after Reauth.
+func (c *Client) get(ctx context.Context, endpoint, u string) (*goquery.Document, *http.Response, error) {
+	gen := c.sessionGen.Load()
+	doc, res, err := c.send(ctx, endpoint, http.MethodGet, u, nil)
+	if !errors.Is(err, ErrSessionExpired) || c.Reauth == nil {
+		return doc, res, err
+	}
+	if err := c.reauth(ctx, gen); err != nil {
+		return doc, res, err
+	}
+	return c.send(withoutReauth(ctx), endpoint, http.MethodGet, u, nil)
+}
+
+// A POST is never replayed; the form it sent belongs to the old session.
+func (c *Client) postForm(ctx context.Context, endpoint, u string, data url.Values) (*goquery.Document, *http.Response, error) {
+	return c.send(ctx, endpoint, http.MethodPost, u, strings.NewReader(data.Encode()))
+}
+
+func (c *Client) send(ctx context.Context, endpoint, method, u string, body io.Reader) (*goquery.Document, *http.Response, error) {
+	req, err := http.NewRequestWithContext(httpx.WithEndpoint(ctx, endpoint), method, u, body)
 	if err != nil {
 		return nil, nil, err
 	}
-	doc, err := goquery.NewDocumentFromReader(res.Body)
-	return doc, res, err
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.Header.Set("User-Agent", c.UA)
+	return c.do(req)
 }
 
 func (c *Client) Login(ctx context.Context, username, password string) error {
-	log := c.Log
+	ctx = withoutReauth(ctx)
+	log := telemetry.Ctx(ctx, c.Log)
 	log.Info().Msg("🔐 starting login process")
 
 	// 1️⃣ fetch login page
-	doc, _, err := c.get(ctx, c.Base.LoginURL)
+	doc, res, err := c.get(ctx, "login", c.Base.LoginURL)
 	if err != nil {
-		return err
+		return c.statusFailure(doc, res, err)
+	}
+	if lerr := c.loginFailure(doc, res); lerr != nil && lerr.Cause == CauseMaintenance {
+		return lerr
 	}
 
 	// 1.5️⃣ detect existing session → logout first
-	if doc.Find(`form[action*="logout.php"]`).Length() > 0 {
+	if doc.Find(c.profile().Selectors.LogoutForm).Length() > 0 {
 		log.Info().Msg("⚠️  already logged in, performing logout first")
 		sesskey, _ := doc.Find(`input[name="sesskey"]`).Attr("value")
 		form := url.Values{
 			"sesskey":   {sesskey},
 			"loginpage": {"1"},
 		}
-		_, resp, err := c.postForm(ctx, "https://elearning.budiluhur.ac.id/login/logout.php", form)
+		_, resp, err := c.postForm(ctx, "logout", c.logoutURL(doc), form)
 		if err != nil {
 			log.Error().Err(err).Msg("logout request failed")
 			return err
 		}
 		log.Info().Int("status", resp.StatusCode).Msg("✅ logout success, refetching login page")
 		// re-fetch login page after logout
-		doc, _, err = c.get(ctx, c.Base.LoginURL)
+		doc, _, err = c.get(ctx, "login", c.Base.LoginURL)
 		if err != nil {
 			return fmt.Errorf("failed to refetch login page after logout: %w", err)
 		}
@@ -101,7 +207,7 @@ func (c *Client) Login(ctx context.Context, username, password string) error {
 		}
 		return errors.New("missing login token")
 	}
-	log.Info().Str("token", logintoken).Msg("✅ login token extracted")
+	log.Info().Msg("✅ login token extracted")
 
 	// 3️⃣ submit login form
 	form := url.Values{
@@ -110,32 +216,93 @@ func (c *Client) Login(ctx context.Context, username, password string) error {
 		"logintoken": {logintoken},
 	}
 	log.Info().Msg("🚀 submitting login form")
-	_, resp, err := c.postForm(ctx, c.Base.LoginURL, form)
-	if err != nil {
+	page, resp, err := c.postForm(ctx, "login", c.Base.LoginURL, form)
+	var lerr *LoginError
+	switch {
+	case err == nil:
+		log.Info().Int("status", resp.StatusCode).Msg("login response received")
+		lerr = c.loginFailure(page, resp)
+	case !errors.As(c.statusFailure(page, resp, err), &lerr):
 		log.Error().Err(err).Msg("login request failed")
 		return err
 	}
-	log.Info().Int("status", resp.StatusCode).Msg("login response received")
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
-		return fmt.Errorf("login http status %d", resp.StatusCode)
+	if lerr != nil {
+		log.Warn().Str("cause", string(lerr.Cause)).Str("message", lerr.Message).Msg("⛔ login rejected")
+		return lerr
 	}
 
 	// 4️⃣ sanity check — verify no login form in courses page
-	courses, _, err := c.get(ctx, c.Base.CoursesURL)
+	courses, _, err := c.get(ctx, "courses", c.Base.CoursesURL)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to fetch courses page after login")
 		return err
 	}
-	if courses.Find(`#username`).Length() > 0 {
+	if courses.Find(c.profile().Selectors.LoginUsername).Length() > 0 {
 		log.Warn().Msg("⚠️ login still showing username field, likely failed")
 		return errors.New("login failed: username field still present")
 	}
 
+	// 5️⃣ identity — the user menu should name the account we logged into
+	name := c.userName(courses)
+	switch {
+	case name == "":
+		log.Warn().Msg("⚠️ no user menu found, skipping identity check")
+	case c.Identity != "" && !has(name, []string{c.Identity}):
+		return &LoginError{Cause: CauseWrongAccount, Message: fmt.Sprintf("user menu shows %q", name)}
+	default:
+		log.Info().Str("user", name).Msg("👤 logged in as")
+	}
+
 	log.Info().Msg("✅ login successful and verified")
 	return nil
 }
 
+// logoutURL prefers the configured endpoint, then the logout form on the page.
+func (c *Client) logoutURL(doc *goquery.Document) string {
+	if c.Base.LogoutURL != "" {
+		return c.Base.LogoutURL
+	}
+	action, _ := doc.Find(c.profile().Selectors.LogoutForm).Attr("action")
+	if ref, err := url.Parse(action); err == nil {
+		if base, err := url.Parse(c.Base.LoginURL); err == nil {
+			return base.ResolveReference(ref).String()
+		}
+	}
+	return action
+}
+
+// LoggedIn reports whether the current cookies still open the courses page.
+func (c *Client) LoggedIn(ctx context.Context) (bool, error) {
+	doc, _, err := c.get(withoutReauth(ctx), "courses", c.Base.CoursesURL)
+	if err != nil {
+		return false, err
+	}
+	return doc.Find(c.profile().Selectors.LoginUsername).Length() == 0, nil
+}
+
+// Cookies returns the session cookies the jar holds for the site.
+func (c *Client) Cookies() []*http.Cookie {
+	u, err := url.Parse(c.Base.LoginURL)
+	if err != nil || c.Jar == nil {
+		return nil
+	}
+	return c.Jar.Cookies(u)
+}
+
+// SetCookies restores cookies saved by Cookies, e.g. from the vault.
+func (c *Client) SetCookies(cs []*http.Cookie) {
+	u, err := url.Parse(c.Base.LoginURL)
+	if err != nil || c.Jar == nil || len(cs) == 0 {
+		return
+	}
+	for _, ck := range cs {
+		if ck.Path == "" {
+			ck.Path = "/"
+		}
+	}
+	c.Jar.SetCookies(u, cs)
+}
+
 type Course struct {
 	CourseName string
 	CourseLink string
@@ -155,21 +322,30 @@ type Attendance struct {
 
 // GetCourses parses the overview table similar to the TS version.
 func (c *Client) GetCourses(ctx context.Context) ([]Course, error) {
-	doc, _, err := c.get(ctx, c.Base.CoursesURL)
+	doc, res, err := c.get(ctx, "courses", c.Base.CoursesURL)
 	if err != nil {
 		return nil, err
 	}
-	return parseCourses(doc)
+	c.observe(ctx, "courses", res, doc)
+	cs, err := parseCourses(doc, c.profile())
+	if err == nil && len(cs) == 0 {
+		c.snapshot(ctx, "courses", res, doc, "no course parsed")
+	}
+	return cs, err
 }
 
 func (c *Client) GetAttendance(ctx context.Context, cr Course) ([]Attendance, error) {
 	courseID := fmt.Sprintf("%d", cr.CourseID)
 	u := fmt.Sprintf("%s?id=%s", c.Base.AttendanceListURL, courseID)
-	doc, _, err := c.get(ctx, u)
+	doc, res, err := c.get(ctx, "attendance_list", u)
 	if err != nil {
 		return nil, err
 	}
-	return parseAttendanceList(doc, cr), nil
+	// a course without attendance shows a notice instead of the table
+	if !has(doc.Find(c.profile().Selectors.Notice).Text(), c.profile().Labels.NoAttendance) {
+		c.observe(ctx, "attendance_list", res, doc)
+	}
+	return parseAttendanceList(doc, cr, c.profile()), nil
 }
 
 type FormInfo struct {
@@ -181,10 +357,11 @@ type FormInfo struct {
 }
 
 func (c *Client) GetFormInfo(ctx context.Context, submitLink, wantSessID, wantSessKey string) (FormInfo, error) {
-	doc, _, err := c.get(ctx, submitLink)
+	doc, res, err := c.get(ctx, "form", submitLink)
 	if err != nil {
 		return FormInfo{}, err
 	}
+	c.observe(ctx, "form", res, doc)
 	fi := parseFormInfo(doc)
 	if fi.SessID != wantSessID || fi.SessKey != wantSessKey {
 		return FormInfo{}, errors.New("form sess mismatch")
@@ -192,24 +369,52 @@ func (c *Client) GetFormInfo(ctx context.Context, submitLink, wantSessID, wantSe
 	return fi, nil
 }
 
-func (c *Client) SubmitAttendance(ctx context.Context, formURL string, fi FormInfo) error {
+// Submission is the evidence of one SubmitAttendance call.
+type Submission struct {
+	RequestAt  time.Time
+	ResponseAt time.Time
+	StatusCode int    // 0 when no response arrived
+	Page       []byte // confirmation page after redirects, as received
+}
+
+// SubmitAttendance posts the attendance form once; a failed attempt may
+// still have been recorded, so check before sending it again.
+func (c *Client) SubmitAttendance(ctx context.Context, formURL string, fi FormInfo) (Submission, error) {
 	data := url.Values{
 		"sessid":  {fi.SessID},
 		"sesskey": {fi.SessKey},
 		"_qf__mod_attendance_form_studentattendance": {fi.QF},
 		"mform_isexpanded_id_session":                {fi.IsExp},
 		"status":                                     {fi.Status},
-		"submitbutton":                               {"Save changes"},
+		"submitbutton":                               {c.profile().Labels.SaveChanges},
+	}
+	sub := Submission{RequestAt: time.Now()}
+	_, resp, err := c.postForm(ctx, "submit", c.Base.AttendanceFormURL, data)
+	sub.ResponseAt = time.Now()
+	if resp != nil {
+		sub.StatusCode = resp.StatusCode
+		// the raw bytes, not doc.Html(): a re-rendered page would not
+		// hash to what the server sent
+		sub.Page, _ = io.ReadAll(resp.Body)
 	}
-	_, _, err := c.postForm(ctx, c.Base.AttendanceFormURL, data)
-	return err
+	return sub, err
 }
 
-func (c *Client) CheckSubmitted(ctx context.Context, attendanceID string) (bool, error) {
+// CheckSubmitted reads the view page again and finds the row of before,
+// a session log row from the page the submit link was on: by its submit
+// link while it has one, else by its date. It reports whether that row
+// turned self-recorded since, and returns it; a zero Session when no row
+// matches.
+func (c *Client) CheckSubmitted(ctx context.Context, attendanceID string, before Session) (Session, bool, error) {
 	u := fmt.Sprintf("%s?id=%s", c.Base.AttendanceURL, attendanceID)
-	doc, _, err := c.get(ctx, u)
+	doc, _, err := c.get(ctx, "view", u)
 	if err != nil {
-		return false, err
+		return Session{}, false, err
+	}
+	for _, row := range parseSessions(doc, c.Loc, c.profile()) {
+		if (before.SessID != "" && row.SessID == before.SessID) || (before.Date != "" && row.Date == before.Date) {
+			return row, row.SelfRecorded && (!before.SelfRecorded || row.Status != before.Status), nil
+		}
 	}
-	return doc.Find("td:contains('Self-recorded')").Length() > 0, nil
+	return Session{}, false, nil
 }
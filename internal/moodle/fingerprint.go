@@ -0,0 +1,69 @@
+package moodle
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/emandor/gostudentubl/internal/fingerprint"
+	"github.com/emandor/gostudentubl/internal/telemetry"
+)
+
+// formInputs are the fields SubmitAttendance posts back.
+var formInputs = []string{"sessid", "sesskey", "_qf__mod_attendance_form_studentattendance", "mform_isexpanded_id_session", "status"}
+
+// fingerprintOf counts the selectors the parser of page relies on. Cell
+// selectors are only measured when the rows have cells at all, so an empty
+// table is not mistaken for a changed one.
+func fingerprintOf(page string, doc *goquery.Document, p Profile) fingerprint.Fingerprint {
+	s := p.Selectors
+	counts := map[string]int{}
+	count := func(sels ...string) {
+		for _, sel := range sels {
+			counts[sel] = doc.Find(sel).Length()
+		}
+	}
+	within := func(rows string, cells ...string) {
+		count(rows)
+		if doc.Find(rows+" td").Length() == 0 {
+			return
+		}
+		for _, c := range cells {
+			count(rows + " " + c)
+		}
+	}
+	switch page {
+	case "courses":
+		count(s.LogoutForm)
+		within(s.CourseRows, s.CourseLink, s.CourseGrade)
+	case "attendance_list":
+		within(s.AttendanceRows, s.AttendanceTitle, s.AttendanceLink)
+	case "view":
+		within(s.SessionRows, s.SessionDate, s.SessionDesc, s.SessionStatus, s.SessionPoints)
+	case "form":
+		for _, name := range formInputs {
+			count("input[name='" + name + "']")
+		}
+	}
+	return fingerprint.Fingerprint{Page: page, Counts: counts}
+}
+
+// observe checks the page against its baseline in Fingerprints and keeps a
+// snapshot the first time a page type drifts.
+func (c *Client) observe(ctx context.Context, page string, res *http.Response, doc *goquery.Document) {
+	if c.Fingerprints == nil || doc == nil {
+		return
+	}
+	log := telemetry.Ctx(ctx, c.Log)
+	missing, changed, err := c.Fingerprints.Observe(fingerprintOf(page, doc, c.profile()))
+	if err != nil {
+		log.Warn().Err(err).Str("page", page).Msg("fingerprint")
+		return
+	}
+	if len(missing) > 0 && changed {
+		log.Warn().Str("page", page).Strs("missing", missing).Msg("🧬 page markup drifted from baseline")
+		c.snapshot(ctx, page, res, doc, "markup drift: "+strings.Join(missing, ", "))
+	}
+}
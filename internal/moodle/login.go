@@ -0,0 +1,97 @@
+package moodle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/emandor/gostudentubl/internal/httpx"
+)
+
+// LoginCause says why Moodle turned a login down.
+type LoginCause string
+
+const (
+	CauseInvalidCredentials LoginCause = "invalid_credentials"
+	CauseAccountLocked      LoginCause = "account_locked"
+	CauseMaintenance        LoginCause = "maintenance"
+	CausePasswordExpired    LoginCause = "password_expired"
+	CauseWrongAccount       LoginCause = "wrong_account" // the user menu shows someone else
+)
+
+// LoginError is a login the site rejected for a known reason.
+type LoginError struct {
+	Cause   LoginCause
+	Message string // the site's own wording, when there was one
+}
+
+func (e *LoginError) Error() string {
+	msg := "login failed: " + strings.ReplaceAll(string(e.Cause), "_", " ")
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Permanent reports whether trying again with the same credentials is
+// pointless (or, for wrong passwords, risks the account lockout).
+func (e *LoginError) Permanent() bool {
+	return e.Cause != CauseMaintenance
+}
+
+// loginFailure reads a page from the login flow for the reasons Moodle
+// gives; nil means none was recognised. Only the status, the final URL and
+// the login error box count: the rest of the page carries news items,
+// course names and footers that can contain any of the labels, and a
+// false match here disables logins until someone unlocks them.
+func (c *Client) loginFailure(doc *goquery.Document, res *http.Response) *LoginError {
+	p := c.profile()
+	msg := strings.Join(strings.Fields(doc.Find(p.Selectors.LoginError).First().Text()), " ")
+	switch {
+	case res != nil && res.StatusCode == http.StatusServiceUnavailable, has(msg, p.Labels.Maintenance):
+		return &LoginError{Cause: CauseMaintenance, Message: msg}
+	case res != nil && res.Request != nil && strings.Contains(res.Request.URL.Path, "change_password.php"),
+		has(msg, p.Labels.PasswordExpired):
+		return &LoginError{Cause: CausePasswordExpired, Message: msg}
+	case has(msg, p.Labels.AccountLocked):
+		return &LoginError{Cause: CauseAccountLocked, Message: msg}
+	case has(msg, p.Labels.InvalidLogin):
+		return &LoginError{Cause: CauseInvalidCredentials, Message: msg}
+	}
+	return nil
+}
+
+// statusFailure returns the LoginError the page behind a status error
+// from the login flow explains, or err as is. Retried GETs that gave up
+// come back without a page and stay status errors.
+func (c *Client) statusFailure(doc *goquery.Document, res *http.Response, err error) error {
+	var se *httpx.StatusError
+	if doc == nil || !errors.As(err, &se) {
+		return err
+	}
+	if lerr := c.loginFailure(doc, res); lerr != nil {
+		return lerr
+	}
+	return err
+}
+
+// Ping fetches the login page once, without retries, and reports whether
+// the site is up and not in maintenance.
+func (c *Client) Ping(ctx context.Context) error {
+	doc, res, err := c.get(withoutReauth(httpx.WithoutRetry(ctx)), "probe", c.Base.LoginURL)
+	if err != nil {
+		return c.statusFailure(doc, res, err)
+	}
+	if lerr := c.loginFailure(doc, res); lerr != nil && lerr.Cause == CauseMaintenance {
+		return lerr
+	}
+	return nil
+}
+
+// userName is the name in the user menu, empty when the theme has none.
+func (c *Client) userName(doc *goquery.Document) string {
+	return strings.Join(strings.Fields(doc.Find(c.profile().Selectors.UserMenu).First().Text()), " ")
+}
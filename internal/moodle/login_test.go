@@ -0,0 +1,98 @@
+package moodle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/emandor/gostudentubl/internal/httpx"
+)
+
+func TestLoginFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		path   string
+		body   string
+		want   LoginCause // empty: no failure recognised
+	}{
+		{name: "invalid login box", body: `<div id="loginerrormessage">Invalid login, please try again</div>`, want: CauseInvalidCredentials},
+		{name: "locked box", body: `<div class="loginerrors">Your account has been locked</div>`, want: CauseAccountLocked},
+		{name: "maintenance status", status: http.StatusServiceUnavailable, body: `<p>back soon</p>`, want: CauseMaintenance},
+		{name: "change password redirect", path: "/login/change_password.php", body: `<form></form>`, want: CausePasswordExpired},
+		{name: "labels outside the box", body: `<div class="news">Reminder: your password has expired? Accounts are locked after 5 tries. The site is undergoing maintenance on Sunday.</div>`},
+		{name: "dashboard", body: `<div class="usermenu">Jane Doe</div>`},
+	}
+	c := &Client{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><body>" + tt.body + "</body></html>"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.status == 0 {
+				tt.status = http.StatusOK
+			}
+			if tt.path == "" {
+				tt.path = "/my/"
+			}
+			res := &http.Response{StatusCode: tt.status, Request: &http.Request{URL: &url.URL{Path: tt.path}}}
+
+			lerr := c.loginFailure(doc, res)
+			var got LoginCause
+			if lerr != nil {
+				got = lerr.Cause
+			}
+			if got != tt.want {
+				t.Errorf("cause = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMaintenancePage checks a 503 maintenance page is read as such,
+// although the client turns the status into an error first.
+func TestMaintenancePage(t *testing.T) {
+	const loginPage = `<html><body><form><input name="logintoken" value="tok"></form></body></html>`
+	const maintenance = `<html><body><p>This site is undergoing maintenance and is currently not available</p></body></html>`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		// /down is in maintenance throughout, /login/ only once submitted
+		if r.Method == http.MethodPost || r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(maintenance))
+			return
+		}
+		w.Write([]byte(loginPage))
+	}))
+	defer srv.Close()
+	hc, err := httpx.NewHTTP(5*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		call func(c *Client) error
+	}{
+		{name: "ping", path: "/down", call: func(c *Client) error { return c.Ping(context.Background()) }},
+		{name: "login", path: "/login/index.php", call: func(c *Client) error { return c.Login(context.Background(), "jane", "secret") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{HC: hc, Base: Endpoints{LoginURL: srv.URL + tt.path}}
+			var lerr *LoginError
+			if err := tt.call(c); !errors.As(err, &lerr) || lerr.Cause != CauseMaintenance {
+				t.Errorf("err = %v, want %s", err, CauseMaintenance)
+			}
+		})
+	}
+}
@@ -1,10 +1,11 @@
 package moodle
 
 import (
-	"fmt"
+	"errors"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 )
@@ -13,12 +14,16 @@ var (
 	rexCourseID   = regexp.MustCompile(`id=(\d+)`)
 	rexPeriode    = regexp.MustCompile(`-(\d{4})-`)
 	rexGroupTrail = regexp.MustCompile(`-(\w{1}\d{1})`)
+	rexPoints     = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*/\s*(\d+(?:\.\d+)?)`)
+	rexDateDotted = regexp.MustCompile(`\d{1,2}\.\d{1,2}\.\d{2,4}`)
+	rexDateWords  = regexp.MustCompile(`\d{1,2} [A-Za-z]+ \d{4}`)
+	rexTimeOfDay  = regexp.MustCompile(`(\d{1,2})(?:[:.](\d{2}))?\s*([AaPp][Mm])?`)
 )
 
-func parseCourses(doc *goquery.Document) ([]Course, error) {
+func parseCourses(doc *goquery.Document, p Profile) ([]Course, error) {
 	var cs []Course
-	doc.Find("#overview-grade tbody tr").Each(func(i int, s *goquery.Selection) {
-		anchor := s.Find("td.cell.c0 a")
+	doc.Find(p.Selectors.CourseRows).Each(func(i int, s *goquery.Selection) {
+		anchor := s.Find(p.Selectors.CourseLink)
 		nameRaw := strings.TrimSpace(anchor.Text())
 		if nameRaw == "" {
 			return
@@ -30,7 +35,7 @@ func parseCourses(doc *goquery.Document) ([]Course, error) {
 		}
 
 		var grade *int
-		if g, err := strconv.Atoi(strings.TrimSpace(s.Find("td.cell.c1").Text())); err == nil {
+		if g, err := strconv.Atoi(strings.TrimSpace(s.Find(p.Selectors.CourseGrade).Text())); err == nil {
 			grade = &g
 		}
 		var cid int
@@ -57,14 +62,14 @@ func parseCourses(doc *goquery.Document) ([]Course, error) {
 	return cs, nil
 }
 
-func parseAttendanceList(doc *goquery.Document, cr Course) []Attendance {
-	if strings.TrimSpace(doc.Find("#notice").Text()) == "There are no Attendance in this course" {
+func parseAttendanceList(doc *goquery.Document, cr Course, p Profile) []Attendance {
+	if has(doc.Find(p.Selectors.Notice).Text(), p.Labels.NoAttendance) {
 		return nil
 	}
 	var out []Attendance
-	doc.Find(".generaltable tbody tr").Each(func(i int, s *goquery.Selection) {
-		title := strings.TrimSpace(s.Find("td.cell.c0").Text())
-		nameEl := s.Find("td.cell.c1 a")
+	doc.Find(p.Selectors.AttendanceRows).Each(func(i int, s *goquery.Selection) {
+		title := strings.TrimSpace(s.Find(p.Selectors.AttendanceTitle).Text())
+		nameEl := s.Find(p.Selectors.AttendanceLink)
 		name := strings.TrimSpace(nameEl.Text())
 		link, _ := nameEl.Attr("href")
 		if title == "" || name == "" || link == "" {
@@ -82,10 +87,14 @@ func parseAttendanceList(doc *goquery.Document, cr Course) []Attendance {
 	return out
 }
 
-func parseViewInfo(doc *goquery.Document) (ViewInfo, error) {
+// ErrNoSubmitLink means a view page was fetched but had no submit link,
+// which is normal while no session is open.
+var ErrNoSubmitLink = errors.New("view info not found")
+
+func parseViewInfo(doc *goquery.Document, p Profile) (ViewInfo, error) {
 	var vi ViewInfo
 	doc.Find("a").EachWithBreak(func(i int, s *goquery.Selection) bool {
-		if strings.Contains(strings.TrimSpace(s.Text()), "Submit attendance") {
+		if has(s.Text(), p.Labels.SubmitAttendance) {
 			link, _ := s.Attr("href")
 			if link == "" {
 				return true
@@ -98,11 +107,89 @@ func parseViewInfo(doc *goquery.Document) (ViewInfo, error) {
 		return true
 	})
 	if vi.SubmitLink == "" || vi.SessionID == "" || vi.SessKey == "" {
-		return vi, fmt.Errorf("view info not found")
+		return vi, ErrNoSubmitLink
 	}
 	return vi, nil
 }
 
+// parseSessions reads the student's session log on the attendance view page.
+func parseSessions(doc *goquery.Document, loc *time.Location, p Profile) []Session {
+	var out []Session
+	doc.Find(p.Selectors.SessionRows).Each(func(i int, s *goquery.Selection) {
+		dateCell := s.Find(p.Selectors.SessionDate)
+		if dateCell.Length() == 0 {
+			return
+		}
+		ss := Session{
+			Date:        strings.Join(strings.Fields(dateCell.Text()), " "),
+			Description: strings.TrimSpace(s.Find(p.Selectors.SessionDesc).Text()),
+			Status:      strings.TrimSpace(s.Find(p.Selectors.SessionStatus).Text()),
+		}
+		if m := rexPoints.FindStringSubmatch(s.Find(p.Selectors.SessionPoints).Text()); len(m) == 3 {
+			ss.Earned, _ = strconv.ParseFloat(m[1], 64)
+			ss.Max, _ = strconv.ParseFloat(m[2], 64)
+			ss.Taken = true
+		}
+		if link, ok := s.Find(`a[href*="sessid="]`).Attr("href"); ok {
+			ss.SessID = firstMatch(link, `sessid=(\d+)`)
+		}
+		ss.SelfRecorded = has(s.Text(), p.Labels.SelfRecorded)
+		ss.At = parseSessionDate(p.Labels.englishMonths(ss.Date), loc)
+		out = append(out, ss)
+	})
+	return out
+}
+
+// parseSessionDate understands "Mon 06.10.2025" and "Mon 6 Oct 2025" style dates,
+// followed by the start time when Moodle prints one ("08:00 - 10:00",
+// "8AM - 10AM"); zero if neither date matches, midnight without a time.
+func parseSessionDate(s string, loc *time.Location) time.Time {
+	if loc == nil {
+		loc = time.Local
+	}
+	if i := rexDateDotted.FindStringIndex(s); i != nil {
+		for _, layout := range []string{"2.1.2006", "2.1.06"} {
+			if t, err := time.ParseInLocation(layout, s[i[0]:i[1]], loc); err == nil {
+				return withTimeOfDay(t, s[i[1]:])
+			}
+		}
+	}
+	if i := rexDateWords.FindStringIndex(s); i != nil {
+		for _, layout := range []string{"2 Jan 2006", "2 January 2006"} {
+			if t, err := time.ParseInLocation(layout, s[i[0]:i[1]], loc); err == nil {
+				return withTimeOfDay(t, s[i[1]:])
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// withTimeOfDay moves day to the first time of day in rest, 24-hour or
+// with AM/PM; day is returned as is when rest has none.
+func withTimeOfDay(day time.Time, rest string) time.Time {
+	for _, m := range rexTimeOfDay.FindAllStringSubmatch(rest, -1) {
+		if m[2] == "" && m[3] == "" {
+			continue
+		}
+		h, _ := strconv.Atoi(m[1])
+		mm, _ := strconv.Atoi(m[2])
+		if ampm := strings.ToLower(m[3]); ampm != "" {
+			if h < 1 || h > 12 {
+				continue
+			}
+			h %= 12
+			if ampm == "pm" {
+				h += 12
+			}
+		}
+		if h > 23 || mm > 59 {
+			continue
+		}
+		return time.Date(day.Year(), day.Month(), day.Day(), h, mm, 0, 0, day.Location())
+	}
+	return day
+}
+
 func parseFormInfo(doc *goquery.Document) FormInfo {
 	val := func(name string) string { v, _ := doc.Find("input[name='" + name + "']").Attr("value"); return v }
 	return FormInfo{
@@ -0,0 +1,75 @@
+package moodle
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/emandor/gostudentubl/internal/history"
+)
+
+func TestParseSessionDate(t *testing.T) {
+	day := func(h, m int) time.Time { return time.Date(2025, 10, 6, h, m, 0, 0, time.UTC) }
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{in: "Mon 6 Oct 2025 08:00 - 10:00", want: day(8, 0)},
+		{in: "Mon 06.10.2025 13.30 - 15.00", want: day(13, 30)},
+		{in: "Mon 6 Oct 2025 8AM - 10AM", want: day(8, 0)},
+		{in: "Mon 6 Oct 2025 1:15 PM - 2:45 PM", want: day(13, 15)},
+		{in: "Mon 6 Oct 2025 12AM - 1AM", want: day(0, 0)},
+		{in: "Mon 6 Oct 2025", want: day(0, 0)},
+		{in: "no date here", want: time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := parseSessionDate(tt.in, time.UTC); !got.Equal(tt.want) {
+			t.Errorf("parseSessionDate(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestParsedSessionsInDigest feeds the session log as parsed into the
+// digest, so upcoming is checked against the times the parser produces.
+func TestParsedSessionsInDigest(t *testing.T) {
+	const page = `<table class="generaltable">
+<tr><td class="datecol">Rab 14 Okt 2026 08.00 - 10.00</td><td class="desccol">earlier today</td><td class="statuscol">?</td><td class="pointscol">? / 2</td></tr>
+<tr><td class="datecol">Rab 14 Okt 2026 14.00 - 16.00</td><td class="desccol">later today</td><td class="statuscol">?</td><td class="pointscol">? / 2</td></tr>
+<tr><td class="datecol">Kam 15 Okt 2026 09.00 - 11.00</td><td class="desccol">tomorrow</td><td class="statuscol">?</td><td class="pointscol">? / 2</td></tr>
+</table>`
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loc := time.FixedZone("WITA", 8*3600)
+	var hs []history.Session
+	for _, s := range parseSessions(doc, loc, Profiles["id"]) {
+		h := history.Session{CourseID: 1, Course: "Basis Data", AttendanceID: "7", Description: s.Description, Taken: s.Taken}
+		if !s.At.IsZero() {
+			at := s.At
+			h.At = &at
+		}
+		hs = append(hs, h)
+	}
+
+	st, err := history.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.PutSessions("7", hs); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := st.Summarise("day", time.Date(2026, 10, 14, 12, 0, 0, 0, loc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, s := range sum.Upcoming {
+		got = append(got, s.Description)
+	}
+	if want := "later today,tomorrow"; strings.Join(got, ",") != want {
+		t.Errorf("upcoming = %q, want %s", got, want)
+	}
+}
@@ -0,0 +1,200 @@
+package moodle
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Profile is everything the parsers match on: CSS selectors that depend on
+// the theme and UI texts that depend on the site language. Bump Version
+// whenever a built-in profile changes so the logs show which one ran.
+type Profile struct {
+	Name      string    `json:"name"`
+	Version   int       `json:"version"`
+	Selectors Selectors `json:"selectors"`
+	Labels    Labels    `json:"labels"`
+}
+
+type Selectors struct {
+	CourseRows  string `json:"course_rows"`
+	CourseLink  string `json:"course_link"`
+	CourseGrade string `json:"course_grade"`
+
+	Notice          string `json:"notice"`
+	AttendanceRows  string `json:"attendance_rows"`
+	AttendanceTitle string `json:"attendance_title"`
+	AttendanceLink  string `json:"attendance_link"`
+
+	SessionRows   string `json:"session_rows"`
+	SessionDate   string `json:"session_date"`
+	SessionDesc   string `json:"session_desc"`
+	SessionStatus string `json:"session_status"`
+	SessionPoints string `json:"session_points"`
+
+	LoginUsername string `json:"login_username"` // still on the page means login failed
+	LogoutForm    string `json:"logout_form"`
+	LoginError    string `json:"login_error"` // the message box on a rejected login
+	UserMenu      string `json:"user_menu"`   // shows the logged in user's name
+}
+
+// Labels are matched case-insensitively as substrings; any alternative counts.
+type Labels struct {
+	NoAttendance     []string `json:"no_attendance"`
+	SubmitAttendance []string `json:"submit_attendance"`
+	SelfRecorded     []string `json:"self_recorded"`
+	SaveChanges      string   `json:"save_changes"` // value of the submit button
+	// login failure causes, matched on the page after posting the login form
+	InvalidLogin    []string `json:"invalid_login"`
+	AccountLocked   []string `json:"account_locked"`
+	Maintenance     []string `json:"maintenance"`
+	PasswordExpired []string `json:"password_expired"`
+	// Months maps localized month names in session dates to English.
+	Months map[string]string `json:"months"`
+}
+
+var defaultSelectors = Selectors{
+	CourseRows:      "#overview-grade tbody tr",
+	CourseLink:      "td.cell.c0 a",
+	CourseGrade:     "td.cell.c1",
+	Notice:          "#notice",
+	AttendanceRows:  ".generaltable tbody tr",
+	AttendanceTitle: "td.cell.c0",
+	AttendanceLink:  "td.cell.c1 a",
+	SessionRows:     "table.generaltable tr",
+	SessionDate:     "td.datecol",
+	SessionDesc:     "td.desccol",
+	SessionStatus:   "td.statuscol",
+	SessionPoints:   "td.pointscol",
+	LoginUsername:   "#username",
+	LogoutForm:      `form[action*="logout.php"]`,
+	LoginError:      "#loginerrormessage, .loginerrors, .alert-danger",
+	UserMenu:        ".usermenu .usertext, #user-menu-toggle",
+}
+
+// Profiles are the built-in variants, picked by MOODLE_PROFILE.
+var Profiles = map[string]Profile{
+	"en": {
+		Name:      "en",
+		Version:   2,
+		Selectors: defaultSelectors,
+		Labels: Labels{
+			NoAttendance:     []string{"There are no Attendance in this course"},
+			SubmitAttendance: []string{"Submit attendance"},
+			SelfRecorded:     []string{"Self-recorded"},
+			SaveChanges:      "Save changes",
+			InvalidLogin:     []string{"Invalid login"},
+			AccountLocked:    []string{"account has been locked", "account is locked"},
+			Maintenance:      []string{"undergoing maintenance", "maintenance mode"},
+			PasswordExpired:  []string{"password has expired", "must change your password"},
+		},
+	},
+	"id": {
+		Name:      "id",
+		Version:   2,
+		Selectors: defaultSelectors,
+		Labels: Labels{
+			NoAttendance:     []string{"Tidak ada Kehadiran di kursus ini", "Tidak ada Presensi di kursus ini", "There are no Attendance in this course"},
+			SubmitAttendance: []string{"Kirim kehadiran", "Kirim presensi", "Submit attendance"},
+			SelfRecorded:     []string{"Dicatat sendiri", "Tercatat sendiri", "Self-recorded"},
+			SaveChanges:      "Simpan perubahan",
+			InvalidLogin:     []string{"Login tidak valid", "Invalid login"},
+			AccountLocked:    []string{"akun Anda telah dikunci", "akun telah dikunci", "account has been locked"},
+			Maintenance:      []string{"sedang dalam perawatan", "sedang dalam pemeliharaan", "undergoing maintenance"},
+			PasswordExpired:  []string{"kata sandi Anda telah kedaluwarsa", "harus mengubah kata sandi", "password has expired"},
+			Months: map[string]string{
+				"Januari": "January", "Februari": "February", "Maret": "March", "Mei": "May",
+				"Juni": "June", "Juli": "July", "Agustus": "August", "Oktober": "October",
+				"Desember": "December", "Peb": "Feb", "Mar": "Mar", "Agu": "Aug", "Agt": "Aug",
+				"Okt": "Oct", "Nop": "Nov", "Des": "Dec",
+			},
+		},
+	},
+}
+
+// ProfileNames lists the built-in profiles, sorted.
+func ProfileNames() []string {
+	names := make([]string, 0, len(Profiles))
+	for n := range Profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadProfile reads a JSON profile. Missing selectors fall back to the
+// built-in profile named by its "base" key, or "en".
+func LoadProfile(path string) (Profile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Profile{}, err
+	}
+	var head struct {
+		Base string `json:"base"`
+	}
+	if err := json.Unmarshal(b, &head); err != nil {
+		return Profile{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if head.Base == "" {
+		head.Base = "en"
+	}
+	p, ok := Profiles[head.Base]
+	if !ok {
+		return Profile{}, fmt.Errorf("%s: unknown base profile %q", path, head.Base)
+	}
+	// decoding over the copy keeps the base values for absent keys; only
+	// the label lists and maps are replaced wholesale when present. The
+	// decoder reuses slice backing arrays, so they are cloned first or a
+	// custom profile would rewrite the built-in one.
+	p.Labels = p.Labels.clone()
+	months := p.Labels.Months
+	p.Labels.Months = nil
+	if err := json.Unmarshal(b, &p); err != nil {
+		return Profile{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if p.Labels.Months == nil {
+		p.Labels.Months = months
+	}
+	return p, nil
+}
+
+func (l Labels) clone() Labels {
+	l.NoAttendance = slices.Clone(l.NoAttendance)
+	l.SubmitAttendance = slices.Clone(l.SubmitAttendance)
+	l.SelfRecorded = slices.Clone(l.SelfRecorded)
+	l.InvalidLogin = slices.Clone(l.InvalidLogin)
+	l.AccountLocked = slices.Clone(l.AccountLocked)
+	l.Maintenance = slices.Clone(l.Maintenance)
+	l.PasswordExpired = slices.Clone(l.PasswordExpired)
+	l.Months = maps.Clone(l.Months)
+	return l
+}
+
+// has reports whether text contains any of the labels.
+func has(text string, labels []string) bool {
+	text = strings.ToLower(strings.Join(strings.Fields(text), " "))
+	for _, l := range labels {
+		if l != "" && strings.Contains(text, strings.ToLower(l)) {
+			return true
+		}
+	}
+	return false
+}
+
+// englishMonths rewrites localized month names so time.Parse understands them.
+func (l Labels) englishMonths(s string) string {
+	if len(l.Months) == 0 {
+		return s
+	}
+	words := strings.Fields(s)
+	for i, w := range words {
+		if en, ok := l.Months[w]; ok {
+			words[i] = en
+		}
+	}
+	return strings.Join(words, " ")
+}
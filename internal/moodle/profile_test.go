@@ -0,0 +1,34 @@
+package moodle
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLoadProfileLeavesBuiltinsAlone(t *testing.T) {
+	want := slices.Clone(Profiles["id"].Labels.InvalidLogin)
+	path := filepath.Join(t.TempDir(), "profile.json")
+	custom := `{"base": "id", "labels": {"invalid_login": ["Salah"], "months": {"Mei": "May"}}}`
+	if err := os.WriteFile(path, []byte(custom), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadProfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(p.Labels.InvalidLogin, []string{"Salah"}) {
+		t.Errorf("custom invalid_login = %q", p.Labels.InvalidLogin)
+	}
+	if len(p.Labels.Months) != 1 {
+		t.Errorf("custom months = %v, want only Mei", p.Labels.Months)
+	}
+	if got := Profiles["id"].Labels.InvalidLogin; !slices.Equal(got, want) {
+		t.Errorf("built-in invalid_login changed to %q, want %q", got, want)
+	}
+	if len(Profiles["id"].Labels.Months) < 2 {
+		t.Errorf("built-in months changed to %v", Profiles["id"].Labels.Months)
+	}
+}
@@ -0,0 +1,116 @@
+package moodle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/emandor/gostudentubl/internal/httpx"
+	"github.com/emandor/gostudentubl/internal/telemetry"
+)
+
+// maxBody caps how much of a page is read; Moodle pages are well below.
+const maxBody = 8 << 20
+
+var (
+	// ErrSessionExpired means Moodle sent us to the login page and no
+	// re-login could be made for the request.
+	ErrSessionExpired = errors.New("session expired: redirected to the login page")
+	ErrTooLarge       = fmt.Errorf("response larger than %d bytes", maxBody)
+	ErrNotHTML        = errors.New("response is not HTML")
+)
+
+type noReauthKey struct{}
+
+// withoutReauth marks requests that must see the login page as it is,
+// e.g. the ones Login and LoggedIn make themselves.
+func withoutReauth(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noReauthKey{}, true)
+}
+
+// do sends req and reads the reply as HTML. The body is always closed and
+// read up to maxBody. Status codes from 400 up, non-HTML content and a
+// redirect to the login page are errors; doc and res are still returned
+// when there was a page, for snapshots and audit evidence. res.Body is
+// replaced by the bytes that were read, so the page can be kept exactly
+// as the server sent it.
+func (c *Client) do(req *http.Request) (*goquery.Document, *http.Response, error) {
+	res, err := c.HC.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxBody+1))
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil, res, err
+	}
+	if len(body) > maxBody {
+		return nil, res, ErrTooLarge
+	}
+	var doc *goquery.Document
+	if ct := contentType(res, body); ct == "text/html" || ct == "application/xhtml+xml" {
+		if doc, err = goquery.NewDocumentFromReader(bytes.NewReader(body)); err != nil {
+			return nil, res, err
+		}
+	} else if res.StatusCode < 400 {
+		return nil, res, fmt.Errorf("%w: %s", ErrNotHTML, ct)
+	}
+	// the status wins over the content type, a proxy's 502 is rarely HTML
+	if res.StatusCode >= 400 {
+		return doc, res, &httpx.StatusError{Code: res.StatusCode, Attempts: 1}
+	}
+	if noReauth, _ := req.Context().Value(noReauthKey{}).(bool); !noReauth && c.onLoginPage(res) {
+		return doc, res, ErrSessionExpired
+	}
+	return doc, res, nil
+}
+
+func contentType(res *http.Response, body []byte) string {
+	ct := res.Header.Get("Content-Type")
+	if ct == "" {
+		ct = http.DetectContentType(body)
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return ct
+	}
+	return mt
+}
+
+// onLoginPage reports whether the redirects of res ended on the login page.
+func (c *Client) onLoginPage(res *http.Response) bool {
+	login, err := url.Parse(c.Base.LoginURL)
+	if err != nil || res.Request == nil {
+		return false
+	}
+	got := res.Request.URL
+	return got.Host == login.Host && strings.TrimSuffix(got.Path, "/") == strings.TrimSuffix(login.Path, "/")
+}
+
+// reauth logs in again through Reauth after a GET landed on the login
+// page. Requests that noticed the same expiry concurrently share one
+// login: only the first caller whose session generation is still current
+// logs in.
+func (c *Client) reauth(ctx context.Context, gen uint64) error {
+	c.reauthMu.Lock()
+	defer c.reauthMu.Unlock()
+	if c.sessionGen.Load() != gen {
+		return nil
+	}
+	telemetry.Ctx(ctx, c.Log).Info().Msg("🔑 session expired, logging in again")
+	if err := c.Reauth(withoutReauth(ctx)); err != nil {
+		return fmt.Errorf("%w, re-login failed: %w", ErrSessionExpired, err)
+	}
+	c.sessionGen.Add(1)
+	return nil
+}
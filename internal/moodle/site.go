@@ -0,0 +1,98 @@
+package moodle
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Endpoints are the absolute URLs the client talks to.
+type Endpoints struct {
+	LoginURL          string
+	LogoutURL         string
+	CoursesURL        string
+	AttendanceListURL string
+	AttendanceURL     string
+	AttendanceFormURL string
+}
+
+// Site is a profile of page paths relative to the Moodle base URL, so the
+// same client can run against production, staging or a local install.
+type Site struct {
+	Login          string
+	Logout         string
+	Courses        string
+	AttendanceList string
+	Attendance     string
+	AttendanceForm string
+}
+
+// Sites are the built-in profiles, picked by MOODLE_SITE.
+var Sites = map[string]Site{
+	// stock Moodle with mod_attendance; courses come from the grades overview
+	"moodle": {
+		Login:          "/login/index.php",
+		Logout:         "/login/logout.php",
+		Courses:        "/grade/report/overview/index.php",
+		AttendanceList: "/mod/attendance/index.php",
+		Attendance:     "/mod/attendance/view.php",
+		AttendanceForm: "/mod/attendance/attendance.php",
+	},
+}
+
+// SiteNames lists the built-in profiles, sorted.
+func SiteNames() []string {
+	names := make([]string, 0, len(Sites))
+	for n := range Sites {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// With returns s with some paths replaced. Keys are login, logout, courses,
+// attendance_list, attendance and attendance_form.
+func (s Site) With(paths map[string]string) (Site, error) {
+	for k, p := range paths {
+		switch strings.ToLower(k) {
+		case "login":
+			s.Login = p
+		case "logout":
+			s.Logout = p
+		case "courses":
+			s.Courses = p
+		case "attendance_list":
+			s.AttendanceList = p
+		case "attendance":
+			s.Attendance = p
+		case "attendance_form":
+			s.AttendanceForm = p
+		default:
+			return s, fmt.Errorf("unknown site path %q", k)
+		}
+	}
+	return s, nil
+}
+
+// Endpoints joins every path onto base. A sub-directory in base is kept,
+// so "https://host/moodle" + "/login/index.php" stays under /moodle.
+func (s Site) Endpoints(base string) (Endpoints, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return Endpoints{}, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Endpoints{}, fmt.Errorf("%q is not an absolute http(s) URL", base)
+	}
+	root := strings.TrimRight(u.String(), "/")
+	join := func(p string) string { return root + "/" + strings.TrimLeft(p, "/") }
+	return Endpoints{
+		LoginURL:          join(s.Login),
+		LogoutURL:         join(s.Logout),
+		CoursesURL:        join(s.Courses),
+		AttendanceListURL: join(s.AttendanceList),
+		AttendanceURL:     join(s.Attendance),
+		AttendanceFormURL: join(s.AttendanceForm),
+	}, nil
+}
@@ -0,0 +1,132 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type activeAlert struct {
+	Since time.Time `json:"since"`
+	Event Event     `json:"event"`
+}
+
+// Alerter de-duplicates failure events by key: the first Fail for a key that
+// reaches someone is sent, repeats are swallowed until Resolve sends a
+// single recovery message. A Fail nobody received (quiet hours, severity
+// filters, a render error, every send failing) leaves the key open for the
+// next attempt, so Fail waits for its sends. When Path is set the open
+// alerts survive restarts.
+type Alerter struct {
+	N    *Notifier
+	Path string
+
+	mu     sync.Mutex
+	active map[string]activeAlert
+	loaded bool
+}
+
+// Fail raises ev under key and reports whether a notification was delivered.
+func (a *Alerter) Fail(ctx context.Context, key string, ev Event) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.load()
+	if _, ok := a.active[key]; ok {
+		return false, nil
+	}
+	n, err := a.N.NotifyWait(ctx, ev)
+	if n == 0 {
+		return false, err
+	}
+	a.active[key] = activeAlert{Since: ev.At, Event: ev}
+	return true, errors.Join(err, a.save())
+}
+
+// Resolve closes the alert under key, sending a recovery message if one was
+// open. Alerts that were never announced are not in the table, so they
+// recover silently.
+func (a *Alerter) Resolve(ctx context.Context, key string, at time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.load()
+	open, ok := a.active[key]
+	if !ok {
+		return nil
+	}
+	delete(a.active, key)
+	ev := Event{
+		Type:       EventRecovered,
+		Course:     open.Event.Course,
+		CourseID:   open.Event.CourseID,
+		Attendance: open.Event.Attendance,
+		Link:       open.Event.Link,
+		Detail:     string(open.Event.Type),
+		At:         at,
+	}
+	_, err := a.N.Notify(ctx, ev)
+	return errors.Join(a.save(), err)
+}
+
+// Forget silently drops open alerts whose key has prefix and is not in keep,
+// for things that went away rather than recovered (e.g. a closed session).
+func (a *Alerter) Forget(prefix string, keep map[string]bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.load()
+	changed := false
+	for k := range a.active {
+		if strings.HasPrefix(k, prefix) && !keep[k] {
+			delete(a.active, k)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return a.save()
+}
+
+// Active lists the open alert keys and when each started.
+func (a *Alerter) Active() map[string]time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.load()
+	out := make(map[string]time.Time, len(a.active))
+	for k, v := range a.active {
+		out[k] = v.Since
+	}
+	return out
+}
+
+func (a *Alerter) load() {
+	if a.loaded {
+		return
+	}
+	a.loaded = true
+	a.active = map[string]activeAlert{}
+	if a.Path == "" {
+		return
+	}
+	if b, err := os.ReadFile(a.Path); err == nil {
+		_ = json.Unmarshal(b, &a.active)
+	}
+}
+
+func (a *Alerter) save() error {
+	if a.Path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(a.active, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := a.Path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.Path)
+}
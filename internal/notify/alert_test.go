@@ -0,0 +1,106 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordSender struct {
+	mu   sync.Mutex
+	sent []EventType
+}
+
+func (s *recordSender) Send(_ context.Context, _ string, m Message) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, m.Event.Type)
+	return "1", nil
+}
+
+func (s *recordSender) types() []EventType {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]EventType(nil), s.sent...)
+}
+
+func TestAlerterRetriesUnannounced(t *testing.T) {
+	out := &recordSender{}
+	hub := NewHub()
+	hub.Register("test", out)
+	msgs, err := NewRenderer("en", "UTC", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier := func(routes ...Route) *Notifier {
+		r, err := NewRouter(routes, time.UTC, hub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &Notifier{Hub: hub, Router: r, Messages: msgs}
+	}
+	rc := []Recipient{{Backend: "test", To: "me"}}
+	// as in quiet hours: the outage is routed to nobody
+	quiet := notifier(Route{Events: []EventType{EventRecovered}, Recipients: rc})
+	open := notifier(Route{Recipients: rc})
+
+	ctx := context.Background()
+	a := &Alerter{N: quiet}
+	down := Event{Type: EventSiteDown, At: time.Now()}
+	if sent, err := a.Fail(ctx, "outage", down); sent || err != nil {
+		t.Fatalf("Fail while nobody listens = %v, %v; want nothing sent", sent, err)
+	}
+	if len(a.Active()) != 0 {
+		t.Fatalf("active %v, want the unannounced alert left open for retry", a.Active())
+	}
+
+	a.N = open
+	if sent, err := a.Fail(ctx, "outage", down); !sent || err != nil {
+		t.Fatalf("Fail once routed = %v, %v; want sent", sent, err)
+	}
+	if sent, _ := a.Fail(ctx, "outage", down); sent {
+		t.Fatal("repeat Fail sent again")
+	}
+	if err := a.Resolve(ctx, "outage", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Resolve(ctx, "login", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := hub.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got := out.types()
+	if len(got) != 2 || got[0] != EventSiteDown || got[1] != EventRecovered {
+		t.Errorf("sent %v, want site_down then recovered", got)
+	}
+}
+
+type failSender struct{}
+
+func (failSender) Send(context.Context, string, Message) (string, error) {
+	return "", errors.New("gateway down")
+}
+
+func TestAlerterRetriesUndelivered(t *testing.T) {
+	hub := NewHub()
+	hub.Register("test", failSender{})
+	msgs, err := NewRenderer("en", "UTC", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRouter([]Route{{Recipients: []Recipient{{Backend: "test", To: "me"}}}}, time.UTC, hub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &Alerter{N: &Notifier{Hub: hub, Router: r, Messages: msgs}}
+
+	if sent, err := a.Fail(context.Background(), "outage", Event{Type: EventSiteDown, At: time.Now()}); sent || err != nil {
+		t.Fatalf("Fail with every send failing = %v, %v; want nothing sent", sent, err)
+	}
+	if len(a.Active()) != 0 {
+		t.Errorf("active %v, want the undelivered alert left open for retry", a.Active())
+	}
+}
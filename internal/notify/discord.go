@@ -0,0 +1,130 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type discordPayload struct {
+	Content string         `json:"content,omitempty"`
+	Embeds  []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	URL         string         `json:"url,omitempty"`
+	Color       int            `json:"color"`
+	Timestamp   string         `json:"timestamp,omitempty"`
+	Fields      []discordField `json:"fields,omitempty"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// Discord posts events as embeds to a channel webhook.
+// A non-empty `to` overrides URL, so one backend can serve several channels.
+type Discord struct {
+	URL string
+	HC  *http.Client
+}
+
+func (d *Discord) Send(ctx context.Context, to string, m Message) (string, error) {
+	u := d.URL
+	if to != "" {
+		u = to
+	}
+	if len(m.Events) > 1 {
+		return "", postJSON(ctx, d.HC, u, nil, discordBatchPayload(m))
+	}
+	return "", postJSON(ctx, d.HC, u, nil, discordPayload{Embeds: []discordEmbed{discordEmbedFor(m)}})
+}
+
+func discordEmbedFor(m Message) discordEmbed {
+	ev := m.Event
+	e := discordEmbed{
+		Title:       eventTitle(ev.Type),
+		Description: m.Text,
+		URL:         ev.Link,
+		Color:       eventColor(ev.Type),
+	}
+	if !ev.At.IsZero() {
+		e.Timestamp = ev.At.Format(time.RFC3339)
+	}
+	if ev.Course != "" {
+		e.Fields = append(e.Fields, discordField{Name: "Course", Value: ev.Course, Inline: true})
+	}
+	if ev.Attendance != "" {
+		e.Fields = append(e.Fields, discordField{Name: "Attendance", Value: ev.Attendance, Inline: true})
+	}
+	return e
+}
+
+// discordBatchPayload gives every event its own embed; Discord allows ten per message.
+func discordBatchPayload(m Message) discordPayload {
+	var p discordPayload
+	for i, ev := range m.Events {
+		if i == 10 {
+			p.Content = fmt.Sprintf("+%d more", len(m.Events)-10)
+			break
+		}
+		p.Embeds = append(p.Embeds, discordEmbedFor(Message{Event: ev}))
+	}
+	return p
+}
+
+func eventTitle(t EventType) string {
+	switch t {
+	case EventSubmitted:
+		return "✅ Attendance submitted"
+	case EventFailed:
+		return "❌ Attendance failed"
+	case EventLoginError:
+		return "🔐 Login failed"
+	case EventMarkupChanged:
+		return "🧩 Markup changed"
+	case EventSiteDown:
+		return "🚧 E-learning unavailable"
+	case EventGradePosted:
+		return "📝 Grade posted"
+	case EventDeadlineReminder:
+		return "⏰ Attendance reminder"
+	case EventDigest:
+		return "📊 Attendance digest"
+	case EventRecovered:
+		return "✅ Recovered"
+	default:
+		return string(t)
+	}
+}
+
+func eventColor(t EventType) int {
+	if t == EventSubmitted || t == EventRecovered {
+		return 0x2ecc71
+	}
+	switch t.Severity() {
+	case SeverityError:
+		return 0xe74c3c
+	case SeverityWarning:
+		return 0xf1c40f
+	default:
+		return 0x3498db
+	}
+}
+
+// Ping fetches the webhook, which Discord answers with 200 only for a valid one.
+func (d *Discord) Ping(ctx context.Context) error {
+	resp, err := reachable(ctx, d.HC, http.MethodGet, d.URL)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,366 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/emandor/gostudentubl/internal/history"
+	"github.com/emandor/gostudentubl/internal/metrics"
+	"github.com/emandor/gostudentubl/internal/telemetry"
+)
+
+// Backend names used to register senders on a Hub.
+const (
+	BackendWhatsApp = "whatsapp"
+	BackendDiscord  = "discord"
+	BackendSlack    = "slack"
+	BackendWebhook  = "webhook"
+	BackendTelegram = "telegram"
+)
+
+type EventType string
+
+const (
+	EventSubmitted        EventType = "submitted"
+	EventFailed           EventType = "failed"
+	EventLoginError       EventType = "login_error"
+	EventMarkupChanged    EventType = "markup_changed"
+	EventSiteDown         EventType = "site_down"
+	EventGradePosted      EventType = "grade_posted"
+	EventDeadlineReminder EventType = "deadline_reminder"
+	EventDigest           EventType = "digest"
+	EventRecovered        EventType = "recovered"
+)
+
+// Severity returns how loud an event of this type is by default.
+func (t EventType) Severity() Severity {
+	switch t {
+	case EventFailed, EventLoginError, EventSiteDown:
+		return SeverityError
+	case EventMarkupChanged, EventDeadlineReminder:
+		return SeverityWarning
+	default:
+		return SeverityInfo
+	}
+}
+
+// Event is something that happened during a run that someone may want to hear about.
+type Event struct {
+	Type       EventType `json:"type"`
+	Course     string    `json:"course,omitempty"`
+	CourseID   int       `json:"courseId,omitempty"`
+	Attendance string    `json:"attendance,omitempty"`
+	Link       string    `json:"link,omitempty"`
+	Detail     string    `json:"detail,omitempty"` // error text, grade, deadline...
+	At         time.Time `json:"at"`
+
+	Digest *history.Summary `json:"digest,omitempty"` // EventDigest only
+}
+
+// Message is the rendered text for a recipient plus the event it came from,
+// so backends with rich formatting (embeds, blocks) can use the raw fields.
+type Message struct {
+	Text  string `json:"text"`
+	Event Event  `json:"event"`
+	// Events is set when Text combines several events; Event is then the first.
+	Events []Event `json:"events,omitempty"`
+}
+
+// Sender delivers a message to one recipient and returns the provider's message ID, if any.
+type Sender interface {
+	Send(ctx context.Context, to string, m Message) (string, error)
+}
+
+type Delivery struct {
+	Backend string
+	To      string
+	Message Message
+}
+
+// Pinger is implemented by senders that can check their endpoint without sending a message.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type Hub struct {
+	Senders map[string]Sender
+	// Log is used when the context passed to Dispatch carries no logger.
+	Log zerolog.Logger
+
+	inflight sync.WaitGroup
+}
+
+func NewHub() *Hub { return &Hub{Senders: map[string]Sender{}} }
+
+func (h *Hub) Register(backend string, s Sender) { h.Senders[backend] = s }
+
+func (h *Hub) Has(backend string) bool {
+	_, ok := h.Senders[backend]
+	return ok
+}
+
+// RichBackends lists the registered backends other than WhatsApp, in a stable order.
+func (h *Hub) RichBackends() []string {
+	var out []string
+	for _, b := range []string{BackendDiscord, BackendSlack, BackendWebhook} {
+		if h.Has(b) {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// Send delivers one message and waits for the outcome.
+func (h *Hub) Send(ctx context.Context, d Delivery) (string, error) {
+	s, ok := h.Senders[d.Backend]
+	if !ok {
+		return "", fmt.Errorf("no sender for backend %q", d.Backend)
+	}
+	return send(ctx, s, d)
+}
+
+// send delivers d and counts the result per backend.
+func send(ctx context.Context, s Sender, d Delivery) (string, error) {
+	id, err := s.Send(ctx, d.To, d.Message)
+	metrics.Notifications.WithLabelValues(d.Backend, metrics.Result(err)).Inc()
+	return id, err
+}
+
+// Wait blocks until every dispatched delivery finished or ctx is done.
+func (h *Hub) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Dispatch sends every delivery concurrently and returns immediately with
+// the number handed to a sender. The sends outlive ctx but keep its
+// values, so they log with the caller's run ID.
+func (h *Hub) Dispatch(ctx context.Context, ds []Delivery) int {
+	n, wait := h.start(context.WithoutCancel(ctx), ds)
+	// fire-and-forget; Wait covers a graceful shutdown
+	go func() {
+		wait()
+		telemetry.Ctx(ctx, h.Log).Debug().Msg("notify: all notify tasks completed")
+	}()
+	return n
+}
+
+// Deliver sends every delivery concurrently, waits for them and returns
+// how many were confirmed delivered.
+func (h *Hub) Deliver(ctx context.Context, ds []Delivery) int {
+	_, wait := h.start(ctx, ds)
+	return wait()
+}
+
+// start launches a send per delivery with a sender and returns how many
+// it launched and a wait that returns how many of those succeeded.
+func (h *Hub) start(ctx context.Context, ds []Delivery) (int, func() int) {
+	log := telemetry.Ctx(ctx, h.Log)
+	var wg sync.WaitGroup
+	var delivered atomic.Int32
+	n := 0
+	for _, d := range ds {
+		s, ok := h.Senders[d.Backend]
+		if !ok {
+			log.Warn().Str("backend", d.Backend).Msg("notify: no sender for backend")
+			continue
+		}
+		n++
+		wg.Add(1)
+		h.inflight.Add(1)
+		go func(d Delivery) {
+			defer h.inflight.Done()
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			defer cancel()
+			id, err := send(ctx, s, d)
+			if err != nil {
+				log.Warn().Err(err).Str("backend", d.Backend).Str("to", d.To).Msg("notify failed")
+				return
+			}
+			delivered.Add(1)
+			log.Info().Str("backend", d.Backend).Str("to", d.To).Str("id", id).Msg("notify sent")
+		}(d)
+	}
+	return n, func() int {
+		wg.Wait()
+		return int(delivered.Load())
+	}
+}
+
+// Notifier routes an event, renders it once per audience and dispatches it.
+type Notifier struct {
+	Hub      *Hub
+	Router   *Router
+	Messages *Renderer
+}
+
+// Location is the configured time zone, events should carry times in it.
+func (n *Notifier) Location() *time.Location { return n.Messages.Location() }
+
+// Notify sends ev to everyone the router picks and returns how many
+// deliveries went out; zero when quiet hours or severities filtered every
+// recipient.
+func (n *Notifier) Notify(ctx context.Context, ev Event) (int, error) {
+	ds, err := n.deliveries(ev)
+	if err != nil || len(ds) == 0 {
+		return 0, err
+	}
+	return n.Hub.Dispatch(ctx, ds), nil
+}
+
+// NotifyWait is Notify waiting for the sends: it returns how many
+// deliveries were confirmed, not just started.
+func (n *Notifier) NotifyWait(ctx context.Context, ev Event) (int, error) {
+	ds, err := n.deliveries(ev)
+	if err != nil || len(ds) == 0 {
+		return 0, err
+	}
+	return n.Hub.Deliver(ctx, ds), nil
+}
+
+// deliveries routes ev and renders it once per audience.
+func (n *Notifier) deliveries(ev Event) ([]Delivery, error) {
+	recipients := n.Router.Resolve(ev, time.Now())
+	texts := map[Audience]string{}
+	var ds []Delivery
+	for _, rc := range recipients {
+		text, ok := texts[rc.Audience]
+		if !ok {
+			var err error
+			if text, err = n.Messages.Render(rc.Audience, ev); err != nil {
+				return nil, err
+			}
+			texts[rc.Audience] = text
+		}
+		ds = append(ds, Delivery{Backend: rc.Backend, To: rc.To, Message: Message{Text: text, Event: ev}})
+	}
+	return ds, nil
+}
+
+// NewBatch starts collecting events for one run; ctx is used by Flush.
+func (n *Notifier) NewBatch(ctx context.Context) *Batch { return &Batch{n: n, ctx: ctx} }
+
+// Batch collects events and on Flush sends each recipient a single message
+// combining everything routed to it.
+type Batch struct {
+	n      *Notifier
+	ctx    context.Context
+	mu     sync.Mutex
+	events []Event
+}
+
+func (b *Batch) Add(ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events = append(b.events, ev)
+}
+
+func (b *Batch) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.events)
+}
+
+func (b *Batch) Flush() error {
+	b.mu.Lock()
+	events := b.events
+	b.events = nil
+	b.mu.Unlock()
+
+	now := time.Now()
+	var order []Recipient
+	per := map[Recipient][]Event{}
+	for _, ev := range events {
+		for _, rc := range b.n.Router.Resolve(ev, now) {
+			if _, ok := per[rc]; !ok {
+				order = append(order, rc)
+			}
+			per[rc] = append(per[rc], ev)
+		}
+	}
+
+	var errs []error
+	var ds []Delivery
+	for _, rc := range order {
+		evs := per[rc]
+		var text string
+		var err error
+		if len(evs) == 1 {
+			text, err = b.n.Messages.Render(rc.Audience, evs[0])
+		} else {
+			text, err = b.n.Messages.RenderBatch(rc.Audience, evs)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		m := Message{Text: text, Event: evs[0]}
+		if len(evs) > 1 {
+			m.Events = evs
+		}
+		ds = append(ds, Delivery{Backend: rc.Backend, To: rc.To, Message: m})
+	}
+	b.n.Hub.Dispatch(b.ctx, ds)
+	return errors.Join(errs...)
+}
+
+// reachable checks that u answers HTTP at all; any status counts, since
+// most endpoints reject a bare HEAD/GET but still prove DNS, TCP and TLS work.
+func reachable(ctx context.Context, hc *http.Client, method, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// postJSON posts a payload to Discord and Slack, whose replies carry
+// nothing past the status code.
+func postJSON(ctx context.Context, hc *http.Client, endpoint string, headers map[string]string, payload any) error {
+	req, err := jsonRequest(ctx, endpoint, payload)
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("http status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+var severityNames = []string{"info", "warning", "error"}
+
+func (s Severity) String() string {
+	if int(s) < len(severityNames) {
+		return severityNames[s]
+	}
+	return strconv.Itoa(int(s))
+}
+
+func (s *Severity) UnmarshalText(b []byte) error {
+	for i, n := range severityNames {
+		if strings.EqualFold(string(b), n) {
+			*s = Severity(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity %q", b)
+}
+
+func (s Severity) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+// Recipient is one destination on one backend.
+type Recipient struct {
+	Backend  string   `json:"backend"`
+	To       string   `json:"to"`       // chat/group ID, or a webhook URL override
+	Audience Audience `json:"audience"` // me (default) or group
+}
+
+// Route sends matching events to its recipients.
+type Route struct {
+	Name string `json:"name"`
+	// Events to match; empty matches every type.
+	Events []EventType `json:"events"`
+	// Courses to match: a course ID, a case-insensitive glob ("Basis Data*")
+	// or a /regexp/. Empty matches every event, including course-less ones.
+	Courses     []string    `json:"courses"`
+	Recipients  []Recipient `json:"recipients"`
+	QuietHours  string      `json:"quiet_hours"` // "22:00-06:00", local to the configured zone
+	MinSeverity Severity    `json:"min_severity"`
+}
+
+// LoadRoutes reads a JSON array of routes.
+func LoadRoutes(p string) ([]Route, error) {
+	raw, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var rs []Route
+	if err := json.Unmarshal(raw, &rs); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	return rs, nil
+}
+
+// DefaultRoutes mirrors the historical behaviour: successes go to me and the
+// group (plus every rich backend), anything that went wrong and digests go to me only.
+func DefaultRoutes(waMe, waGroup string, extraBackends []string) []Route {
+	ok := Route{Name: "submitted", Events: []EventType{EventSubmitted, EventGradePosted, EventDeadlineReminder}}
+	if waMe != "" {
+		ok.Recipients = append(ok.Recipients, Recipient{Backend: BackendWhatsApp, To: waMe, Audience: AudienceMe})
+	}
+	if waGroup != "" {
+		ok.Recipients = append(ok.Recipients, Recipient{Backend: BackendWhatsApp, To: waGroup, Audience: AudienceGroup})
+	}
+	for _, b := range extraBackends {
+		ok.Recipients = append(ok.Recipients, Recipient{Backend: b, Audience: AudienceGroup})
+	}
+
+	bad := Route{Name: "problems", Events: []EventType{EventFailed, EventLoginError, EventMarkupChanged, EventSiteDown, EventRecovered}}
+	digest := Route{Name: "digest", Events: []EventType{EventDigest}}
+	if waMe != "" {
+		me := Recipient{Backend: BackendWhatsApp, To: waMe, Audience: AudienceMe}
+		bad.Recipients = append(bad.Recipients, me)
+		digest.Recipients = append(digest.Recipients, me)
+	}
+	return []Route{ok, bad, digest}
+}
+
+type compiledRoute struct {
+	Route
+	ids      map[int]bool
+	globs    []string
+	rexes    []*regexp.Regexp
+	quietOn  bool
+	quietBeg int // minutes since midnight
+	quietEnd int
+}
+
+// Router resolves events to recipients.
+type Router struct {
+	routes []compiledRoute
+	loc    *time.Location
+}
+
+// NewRouter validates routes against the registered backends.
+func NewRouter(routes []Route, loc *time.Location, hub *Hub) (*Router, error) {
+	r := &Router{loc: loc}
+	var errs []error
+	for i, rt := range routes {
+		name := rt.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		c := compiledRoute{Route: rt, ids: map[int]bool{}}
+		for _, t := range rt.Events {
+			if !knownEvent(t) {
+				errs = append(errs, fmt.Errorf("route %s: unknown event %q", name, t))
+			}
+		}
+		for _, m := range rt.Courses {
+			switch {
+			case len(m) > 2 && strings.HasPrefix(m, "/") && strings.HasSuffix(m, "/"):
+				re, err := regexp.Compile("(?i)" + m[1:len(m)-1])
+				if err != nil {
+					errs = append(errs, fmt.Errorf("route %s: %w", name, err))
+					continue
+				}
+				c.rexes = append(c.rexes, re)
+			default:
+				if id, err := strconv.Atoi(m); err == nil {
+					c.ids[id] = true
+					continue
+				}
+				if _, err := path.Match(m, ""); err != nil {
+					errs = append(errs, fmt.Errorf("route %s: bad course pattern %q", name, m))
+					continue
+				}
+				c.globs = append(c.globs, strings.ToLower(m))
+			}
+		}
+		if rt.QuietHours != "" {
+			beg, end, err := parseQuietHours(rt.QuietHours)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("route %s: %w", name, err))
+			}
+			c.quietOn, c.quietBeg, c.quietEnd = true, beg, end
+		}
+		for _, rc := range rt.Recipients {
+			if hub != nil && !hub.Has(rc.Backend) {
+				errs = append(errs, fmt.Errorf("route %s: backend %q is not configured", name, rc.Backend))
+			}
+			if rc.Audience != "" && rc.Audience != AudienceMe && rc.Audience != AudienceGroup {
+				errs = append(errs, fmt.Errorf("route %s: unknown audience %q", name, rc.Audience))
+			}
+		}
+		r.routes = append(r.routes, c)
+	}
+	return r, errors.Join(errs...)
+}
+
+// Resolve returns the recipients for ev at time now, without duplicates.
+func (r *Router) Resolve(ev Event, now time.Time) []Recipient {
+	var out []Recipient
+	seen := map[Recipient]bool{}
+	for _, c := range r.routes {
+		if !c.matches(ev) || ev.Type.Severity() < c.MinSeverity || c.quiet(now.In(r.loc)) {
+			continue
+		}
+		for _, rc := range c.Recipients {
+			if rc.Audience == "" {
+				rc.Audience = AudienceMe
+			}
+			if seen[rc] {
+				continue
+			}
+			seen[rc] = true
+			out = append(out, rc)
+		}
+	}
+	return out
+}
+
+func (c compiledRoute) matches(ev Event) bool {
+	if len(c.Events) > 0 {
+		ok := false
+		for _, t := range c.Events {
+			ok = ok || t == ev.Type
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(c.Courses) == 0 {
+		return true
+	}
+	if c.ids[ev.CourseID] {
+		return true
+	}
+	name := strings.ToLower(ev.Course)
+	for _, g := range c.globs {
+		if ok, _ := path.Match(g, name); ok {
+			return true
+		}
+	}
+	for _, re := range c.rexes {
+		if re.MatchString(ev.Course) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c compiledRoute) quiet(t time.Time) bool {
+	if !c.quietOn {
+		return false
+	}
+	m := t.Hour()*60 + t.Minute()
+	if c.quietBeg <= c.quietEnd {
+		return m >= c.quietBeg && m < c.quietEnd
+	}
+	// wraps midnight, e.g. 22:00-06:00
+	return m >= c.quietBeg || m < c.quietEnd
+}
+
+func parseQuietHours(s string) (int, int, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("quiet hours %q: want HH:MM-HH:MM", s)
+	}
+	beg, err := parseClock(from)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return 0, 0, err
+	}
+	return beg, end, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("quiet hours: bad time %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func knownEvent(t EventType) bool {
+	for _, x := range EventTypes {
+		if x == t {
+			return true
+		}
+	}
+	return false
+}
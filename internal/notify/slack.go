@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type slackPayload struct {
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Fields   []slackText `json:"fields,omitempty"`
+	Elements []any       `json:"elements,omitempty"`
+	URL      string      `json:"url,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Slack posts events as Block Kit messages to an incoming webhook.
+// A non-empty `to` overrides URL, so one backend can serve several channels.
+type Slack struct {
+	URL string
+	HC  *http.Client
+}
+
+func (s *Slack) Send(ctx context.Context, to string, m Message) (string, error) {
+	u := s.URL
+	if to != "" {
+		u = to
+	}
+	return "", postJSON(ctx, s.HC, u, nil, slackPayloadFor(m))
+}
+
+func slackPayloadFor(m Message) slackPayload {
+	ev := m.Event
+	title := eventTitle(ev.Type)
+	if len(m.Events) > 1 {
+		// a combined message: the text already lists every event
+		title = fmt.Sprintf("📬 %d updates", len(m.Events))
+		ev = Event{At: ev.At}
+	}
+	blocks := []slackBlock{
+		{Type: "header", Text: &slackText{Type: "plain_text", Text: title}},
+		{Type: "section", Text: &slackText{Type: "mrkdwn", Text: m.Text}},
+	}
+
+	var fields []slackText
+	if ev.Course != "" {
+		fields = append(fields, slackText{Type: "mrkdwn", Text: "*Course*\n" + ev.Course})
+	}
+	if ev.Attendance != "" {
+		fields = append(fields, slackText{Type: "mrkdwn", Text: "*Attendance*\n" + ev.Attendance})
+	}
+	if len(fields) > 0 {
+		blocks = append(blocks, slackBlock{Type: "section", Fields: fields})
+	}
+
+	if ev.Link != "" {
+		blocks = append(blocks, slackBlock{Type: "actions", Elements: []any{
+			slackBlock{Type: "button", Text: &slackText{Type: "plain_text", Text: "Open"}, URL: ev.Link},
+		}})
+	}
+	if !ev.At.IsZero() {
+		blocks = append(blocks, slackBlock{Type: "context", Elements: []any{
+			slackText{Type: "mrkdwn", Text: ev.At.Format(time.RFC1123)},
+		}})
+	}
+	return slackPayload{Text: m.Text, Blocks: blocks}
+}
+
+// Ping only checks reachability, Slack webhooks cannot be validated without posting.
+func (s *Slack) Ping(ctx context.Context) error {
+	_, err := reachable(ctx, s.HC, http.MethodHead, s.URL)
+	return err
+}
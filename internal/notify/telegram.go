@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Telegram sends plain text through the Bot API; `to` is a chat ID.
+type Telegram struct {
+	Token string
+	API   string // defaults to https://api.telegram.org
+	HC    *http.Client
+}
+
+func (t *Telegram) Send(ctx context.Context, to string, m Message) (string, error) {
+	api := t.API
+	if api == "" {
+		api = "https://api.telegram.org"
+	}
+	u := fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimRight(api, "/"), t.Token)
+	req, err := jsonRequest(ctx, u, map[string]any{"chat_id": to, "text": m.Text, "disable_web_page_preview": true})
+	if err != nil {
+		return "", err
+	}
+
+	hc := t.HC
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		// the URL carries the bot token, keep it out of the error
+		return "", fmt.Errorf("telegram: request failed")
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+
+	var v struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+		Result      struct {
+			MessageID int `json:"message_id"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return "", fmt.Errorf("telegram: %s", resp.Status)
+	}
+	if !v.OK {
+		return "", fmt.Errorf("telegram: %s", firstNonEmpty(v.Description, resp.Status))
+	}
+	return strconv.Itoa(v.Result.MessageID), nil
+}
+
+// Ping calls getMe, which also proves the token is valid.
+func (t *Telegram) Ping(ctx context.Context) error {
+	api := t.API
+	if api == "" {
+		api = "https://api.telegram.org"
+	}
+	resp, err := reachable(ctx, t.HC, http.MethodGet, fmt.Sprintf("%s/bot%s/getMe", strings.TrimRight(api, "/"), t.Token))
+	if err != nil {
+		return fmt.Errorf("telegram: request failed")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("telegram: %s", resp.Status)
+	}
+	return nil
+}
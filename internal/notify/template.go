@@ -0,0 +1,162 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/emandor/gostudentubl/internal/history"
+)
+
+//go:embed templates
+var builtinTemplates embed.FS
+
+// Audience selects which flavour of a message to render.
+type Audience string
+
+const (
+	AudienceMe    Audience = "me"
+	AudienceGroup Audience = "group"
+)
+
+// EventTypes lists every event type that must have templates.
+var EventTypes = []EventType{
+	EventSubmitted,
+	EventFailed,
+	EventLoginError,
+	EventMarkupChanged,
+	EventSiteDown,
+	EventGradePosted,
+	EventDeadlineReminder,
+	EventDigest,
+	EventRecovered,
+}
+
+var Locales = []string{"id", "en"}
+
+// Renderer turns events into message text using templates/<locale>/<event>.<audience>.tmpl.
+type Renderer struct {
+	locale string
+	loc    *time.Location
+	tmpl   *template.Template
+}
+
+// NewRenderer parses the built-in templates for locale, overlays any files
+// found in dir (same layout, may be empty) and validates the result.
+func NewRenderer(locale, tz, dir string) (*Renderer, error) {
+	if !validLocale(locale) {
+		return nil, fmt.Errorf("unknown locale %q (want one of %s)", locale, strings.Join(Locales, ", "))
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Renderer{locale: locale, loc: loc}
+	r.tmpl = template.New(locale).Funcs(r.funcs())
+
+	sources := []fs.FS{builtinTemplates}
+	if dir != "" {
+		sources = append(sources, os.DirFS(dir))
+	}
+	for i, src := range sources {
+		root := locale
+		if i == 0 {
+			root = path.Join("templates", locale)
+		}
+		matches, err := fs.Glob(src, path.Join(root, "*.tmpl"))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			raw, err := fs.ReadFile(src, m)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := r.tmpl.New(path.Base(m)).Parse(string(raw)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return r, r.Validate()
+}
+
+// Validate checks every event/audience pair exists and renders with a sample event.
+func (r *Renderer) Validate() error {
+	now := time.Now()
+	sample := Event{Course: "Sample Course", CourseID: 1, Attendance: "Sample Attendance", Link: "https://example.com", Detail: "sample detail", At: now}
+	sample.Digest = &history.Summary{
+		Period:    "day",
+		From:      now,
+		To:        now,
+		Submitted: []history.Record{{At: now, Course: "Sample Course", Attendance: "Sample Attendance"}},
+		Upcoming:  []history.Session{{Course: "Sample Course", Date: "Mon 1 Jan 2024"}},
+		Courses:   []history.CourseStat{{Course: "Sample Course", Earned: 1, Max: 2, Taken: 1}},
+	}
+	var errs []error
+	for _, a := range []Audience{AudienceMe, AudienceGroup} {
+		for _, t := range EventTypes {
+			sample.Type = t
+			if _, err := r.Render(a, sample); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		sample.Type = EventSubmitted
+		if _, err := r.RenderBatch(a, []Event{sample, sample}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Renderer) Render(a Audience, ev Event) (string, error) {
+	return r.execute(fmt.Sprintf("%s.%s.tmpl", ev.Type, a), ev)
+}
+
+// RenderBatch combines several events for one recipient using batch.<audience>.tmpl;
+// the template gets .Events and .Items, the events rendered one by one.
+func (r *Renderer) RenderBatch(a Audience, evs []Event) (string, error) {
+	data := struct {
+		Events []Event
+		Items  []string
+	}{Events: evs}
+	for _, ev := range evs {
+		text, err := r.Render(a, ev)
+		if err != nil {
+			return "", err
+		}
+		data.Items = append(data.Items, text)
+	}
+	return r.execute(fmt.Sprintf("batch.%s.tmpl", a), data)
+}
+
+func (r *Renderer) execute(name string, data any) (string, error) {
+	t := r.tmpl.Lookup(name)
+	if t == nil {
+		return "", fmt.Errorf("template %s/%s not found", r.locale, name)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("template %s/%s: %w", r.locale, name, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// Location is the time zone dates are rendered in.
+func (r *Renderer) Location() *time.Location { return r.loc }
+
+func validLocale(l string) bool {
+	for _, x := range Locales {
+		if x == l {
+			return true
+		}
+	}
+	return false
+}
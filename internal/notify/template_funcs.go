@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"fmt"
+	"reflect"
+	"text/template"
+	"time"
+)
+
+var (
+	weekdays = map[string][7]string{
+		"id": {"Minggu", "Senin", "Selasa", "Rabu", "Kamis", "Jumat", "Sabtu"},
+		"en": {"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+	}
+	months = map[string][12]string{
+		"id": {"Januari", "Februari", "Maret", "April", "Mei", "Juni", "Juli", "Agustus", "September", "Oktober", "November", "Desember"},
+		"en": {"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+	}
+)
+
+// funcs are the template helpers; dates are always shown in the configured zone.
+func (r *Renderer) funcs() template.FuncMap {
+	return template.FuncMap{
+		"date":     r.date,
+		"clock":    r.clock,
+		"datetime": func(t time.Time) string { return r.date(t) + " " + r.clock(t) },
+		"ago":      func(t time.Time) string { return r.ago(time.Since(t)) },
+		"json":     toJSON,
+		"limit":    limit,
+	}
+}
+
+// limit returns at most the first n elements of a slice.
+func limit(n int, v any) any {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice || rv.Len() <= n {
+		return v
+	}
+	return rv.Slice(0, n).Interface()
+}
+
+// date renders e.g. "Senin, 20 Oktober 2026" / "Monday, 20 October 2026".
+func (r *Renderer) date(t time.Time) string {
+	t = t.In(r.loc)
+	return fmt.Sprintf("%s, %d %s %d", weekdays[r.locale][t.Weekday()], t.Day(), months[r.locale][t.Month()-1], t.Year())
+}
+
+// clock renders e.g. "08:01 WIB".
+func (r *Renderer) clock(t time.Time) string {
+	return t.In(r.loc).Format("15:04 MST")
+}
+
+func (r *Renderer) ago(d time.Duration) string {
+	type unit struct {
+		d      time.Duration
+		id, en string
+	}
+	units := []unit{{24 * time.Hour, "hari", "day"}, {time.Hour, "jam", "hour"}, {time.Minute, "menit", "minute"}}
+
+	future := d < 0
+	if future {
+		d = -d
+	}
+	for _, u := range units {
+		if d < u.d {
+			continue
+		}
+		n := int(d / u.d)
+		if r.locale == "id" {
+			if future {
+				return fmt.Sprintf("%d %s lagi", n, u.id)
+			}
+			return fmt.Sprintf("%d %s lalu", n, u.id)
+		}
+		name := u.en
+		if n > 1 {
+			name += "s"
+		}
+		if future {
+			return fmt.Sprintf("in %d %s", n, name)
+		}
+		return fmt.Sprintf("%d %s ago", n, name)
+	}
+	if r.locale == "id" {
+		return "baru saja"
+	}
+	return "just now"
+}
@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"text/template"
+)
+
+// Webhook posts to an arbitrary JSON endpoint. Body is rendered with the
+// Message as data (plus `.To`); when nil the Message itself is sent as JSON.
+// Use the `json` template func to quote values, e.g. {"msg": {{ json .Text }}}.
+type Webhook struct {
+	URL     string
+	Headers map[string]string
+	Body    *template.Template
+	HC      *http.Client
+}
+
+type webhookData struct {
+	Message
+	To string `json:"to,omitempty"`
+}
+
+// ParseWebhookTemplate loads a body template from path.
+func ParseWebhookTemplate(path string) (*template.Template, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return template.New("webhook").Funcs(template.FuncMap{"json": toJSON}).Parse(string(raw))
+}
+
+// Send posts like the WhatsApp gateway does, and reads the reply the same
+// way: the status code, then a "success" or "status" flag and an id if the
+// endpoint answers with JSON.
+func (w *Webhook) Send(ctx context.Context, to string, m Message) (string, error) {
+	var payload any = webhookData{Message: m, To: to}
+	if w.Body != nil {
+		var buf bytes.Buffer
+		if err := w.Body.Execute(&buf, payload); err != nil {
+			return "", fmt.Errorf("render webhook body: %w", err)
+		}
+		if !json.Valid(buf.Bytes()) {
+			return "", fmt.Errorf("webhook body template produced invalid JSON")
+		}
+		payload = json.RawMessage(buf.Bytes())
+	}
+
+	req, err := jsonRequest(ctx, w.URL, payload)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+	return deliver(w.HC, req, gatewayProvider{}.ParseResponse)
+}
+
+func toJSON(v any) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func (w *Webhook) Ping(ctx context.Context) error {
+	_, err := reachable(ctx, w.HC, http.MethodHead, w.URL)
+	return err
+}
@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookReadsReplyLikeGateway(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		reply   string
+		wantID  string
+		wantErr bool
+	}{
+		{name: "plain 204", status: http.StatusNoContent},
+		{name: "json success", status: http.StatusOK, reply: `{"success": true, "id": "m-1"}`, wantID: "m-1"},
+		{name: "200 with status false", status: http.StatusOK, reply: `{"status": false, "message": "chat not found"}`, wantErr: true},
+		{name: "500", status: http.StatusInternalServerError, reply: `oops`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("X-Token") != "t" || r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("headers = %v", r.Header)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.reply))
+			}))
+			defer srv.Close()
+
+			w := &Webhook{URL: srv.URL, Headers: map[string]string{"X-Token": "t"}}
+			id, err := w.Send(context.Background(), "me", Message{Text: "hi"})
+			if id != tt.wantID || (err != nil) != tt.wantErr {
+				t.Errorf("Send = %q, %v; want %q, error %v", id, err, tt.wantID, tt.wantErr)
+			}
+		})
+	}
+}
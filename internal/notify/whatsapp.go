@@ -1,71 +1,127 @@
 package notify
 
 import (
-	"bytes"
-	"encoding/json"
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
-	"sync"
-
-	"github.com/emandor/gostudentubl/internal/config"
+	"sort"
+	"strings"
 )
 
-type GroupMessage struct {
-	Message string
-	GroupID string
+// Provider adapts WhatsApp sends to one gateway's wire format.
+type Provider interface {
+	NewRequest(ctx context.Context, w *WhatsApp, to, text string) (*http.Request, error)
+	// ParseResponse reads the provider reply; it must not trust the status code alone.
+	ParseResponse(status int, body []byte) (SendResult, error)
 }
 
-type WhatsAppPayload struct {
-	Message string `json:"message"`
-	GroupID string `json:"groupId"`
+// SendResult is what a provider reported back for one message.
+type SendResult struct {
+	ID  string
+	OK  bool
+	Err string
 }
 
-func SendWhatsAppConcurrent(msgs []GroupMessage) {
-	var wg sync.WaitGroup
-	client := &http.Client{}
-	cfg, err := config.Load()
+var providers = map[string]Provider{
+	"gateway": gatewayProvider{},
+	"waha":    wahaProvider{},
+	"fonnte":  fonnteProvider{},
+	"wablas":  wablasProvider{},
+	"twilio":  twilioProvider{},
+}
 
-	if err != nil {
-		log.Printf("[WA] config load error: %v", err)
-		return
+// ProviderNames lists the registered WhatsApp providers.
+func ProviderNames() []string {
+	names := make([]string, 0, len(providers))
+	for n := range providers {
+		names = append(names, n)
 	}
+	sort.Strings(names)
+	return names
+}
 
-	for _, m := range msgs {
-		wg.Add(1)
-		go func(m GroupMessage) {
-			defer wg.Done()
+// WhatsApp sends plain text messages through a WhatsApp gateway; `to` is a chat or group ID.
+type WhatsApp struct {
+	Provider string // see ProviderNames, "" means "gateway"
+	Endpoint string
+	Token    string
+	Session  string // waha session name
+	From     string // twilio sender number
+	Account  string // twilio account SID
+	HC       *http.Client
+}
 
-			payload := WhatsAppPayload{
-				Message: m.Message,
-				GroupID: m.GroupID,
-			}
+func (w *WhatsApp) provider() (Provider, error) {
+	name := strings.ToLower(w.Provider)
+	if name == "" {
+		name = "gateway"
+	}
+	p, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown whatsapp provider %q (want one of %s)", w.Provider, strings.Join(ProviderNames(), ", "))
+	}
+	return p, nil
+}
 
-			data, _ := json.Marshal(payload)
-			waEndpoint := cfg.WAEndpoint
-			waToken := cfg.WAToken
-			req, _ := http.NewRequest("POST", waEndpoint, bytes.NewBuffer(data))
-			req.Header.Set("Authorization", waToken)
-			req.Header.Set("Content-Type", "application/json")
+// Validate reports configuration problems before the first send.
+func (w *WhatsApp) Validate() error {
+	p, err := w.provider()
+	if err != nil {
+		return err
+	}
+	if _, ok := p.(twilioProvider); ok && (w.Account == "" || w.From == "") {
+		return fmt.Errorf("twilio provider needs WA_ACCOUNT_SID and WA_FROM")
+	}
+	return nil
+}
 
-			resp, err := client.Do(req)
-			if err != nil {
-				log.Printf("[WA] failed send to %s: %v", m.GroupID, err)
-				return
-			}
-			defer resp.Body.Close()
+func (w *WhatsApp) Send(ctx context.Context, to string, m Message) (string, error) {
+	p, err := w.provider()
+	if err != nil {
+		return "", err
+	}
+	req, err := p.NewRequest(ctx, w, to, m.Text)
+	if err != nil {
+		return "", err
+	}
+
+	return deliver(w.HC, req, p.ParseResponse)
+}
 
-			if resp.StatusCode >= 300 {
-				log.Printf("[WA] notify failed to %s: %s", m.GroupID, resp.Status)
-			} else {
-				log.Printf("[WA] notify sent to %s", m.GroupID)
-			}
-		}(m)
+// deliver sends req and judges the reply with parse. WhatsApp providers
+// and the generic webhook share it, so both time out, read replies and
+// classify failures the same way.
+func deliver(hc *http.Client, req *http.Request, parse func(status int, body []byte) (SendResult, error)) (string, error) {
+	if hc == nil {
+		hc = http.DefaultClient
 	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+
+	res, err := parse(resp.StatusCode, body)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", resp.Status, err)
+	}
+	if !res.OK {
+		if res.Err == "" {
+			res.Err = resp.Status
+		}
+		return res.ID, errors.New(res.Err)
+	}
+	return res.ID, nil
+}
 
-	// we don't wait for `wg.Wait()` to allow fire-and-forget
-	// but if you want a "graceful shutdown", you can choose to wait for all to finish
-	go func() {
-		wg.Wait()
-		log.Println("[WA] all notify tasks completed")
-	}()
+// Ping checks the gateway answers; it does not send a message.
+func (w *WhatsApp) Ping(ctx context.Context) error {
+	_, err := reachable(ctx, w.HC, http.MethodHead, w.Endpoint)
+	return err
 }
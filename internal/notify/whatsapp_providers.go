@@ -0,0 +1,289 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type WhatsAppPayload struct {
+	Message string `json:"message"`
+	GroupID string `json:"groupId"`
+}
+
+// gatewayProvider is the original self-hosted gateway: {message, groupId} with a raw Authorization header.
+type gatewayProvider struct{}
+
+func (gatewayProvider) NewRequest(ctx context.Context, w *WhatsApp, to, text string) (*http.Request, error) {
+	req, err := jsonRequest(ctx, w.Endpoint, WhatsAppPayload{Message: text, GroupID: to})
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", w.Token)
+	return req, nil
+}
+
+func (gatewayProvider) ParseResponse(status int, body []byte) (SendResult, error) {
+	res := SendResult{OK: status < 300}
+	var v struct {
+		Success   *bool           `json:"success"`
+		Status    json.RawMessage `json:"status"`
+		ID        string          `json:"id"`
+		MessageID string          `json:"messageId"`
+		Message   string          `json:"message"`
+		Error     string          `json:"error"`
+	}
+	if json.Unmarshal(body, &v) != nil {
+		// not every gateway build answers with JSON, the status code is all we get
+		if !res.OK {
+			res.Err = snippet(body)
+		}
+		return res, nil
+	}
+	res.ID = firstNonEmpty(v.ID, v.MessageID)
+	if v.Success != nil {
+		res.OK = res.OK && *v.Success
+	}
+	if ok, known := statusFlag(v.Status); known {
+		res.OK = res.OK && ok
+	}
+	if !res.OK {
+		res.Err = firstNonEmpty(v.Error, v.Message, snippet(body))
+	}
+	return res, nil
+}
+
+// wahaProvider speaks the WAHA HTTP API: POST {endpoint}/api/sendText.
+type wahaProvider struct{}
+
+func (wahaProvider) NewRequest(ctx context.Context, w *WhatsApp, to, text string) (*http.Request, error) {
+	session := w.Session
+	if session == "" {
+		session = "default"
+	}
+	u := strings.TrimRight(w.Endpoint, "/") + "/api/sendText"
+	req, err := jsonRequest(ctx, u, map[string]string{"session": session, "chatId": to, "text": text})
+	if err != nil {
+		return nil, err
+	}
+	if w.Token != "" {
+		req.Header.Set("X-Api-Key", w.Token)
+	}
+	return req, nil
+}
+
+func (wahaProvider) ParseResponse(status int, body []byte) (SendResult, error) {
+	var v struct {
+		ID      json.RawMessage `json:"id"`
+		Message string          `json:"message"`
+		Error   string          `json:"error"`
+	}
+	if err := json.Unmarshal(body, &v); err != nil {
+		if status >= 300 {
+			return SendResult{Err: snippet(body)}, nil
+		}
+		return SendResult{}, fmt.Errorf("waha: decode response: %w", err)
+	}
+	// id is either a plain string or {"_serialized": "..."} depending on the engine
+	id := ""
+	var s string
+	var obj struct {
+		Serialized string `json:"_serialized"`
+	}
+	if json.Unmarshal(v.ID, &s) == nil {
+		id = s
+	} else if json.Unmarshal(v.ID, &obj) == nil {
+		id = obj.Serialized
+	}
+	res := SendResult{ID: id, OK: status < 300 && id != ""}
+	if !res.OK {
+		res.Err = firstNonEmpty(v.Error, v.Message, "no message id in response")
+	}
+	return res, nil
+}
+
+// fonnteProvider posts a form with target/message; the reply carries {"status": bool, "id": [...]}.
+type fonnteProvider struct{}
+
+func (fonnteProvider) NewRequest(ctx context.Context, w *WhatsApp, to, text string) (*http.Request, error) {
+	req, err := formRequest(ctx, w.Endpoint, url.Values{"target": {to}, "message": {text}})
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", w.Token)
+	return req, nil
+}
+
+func (fonnteProvider) ParseResponse(status int, body []byte) (SendResult, error) {
+	var v struct {
+		Status bool     `json:"status"`
+		ID     []string `json:"id"`
+		Reason string   `json:"reason"`
+		Detail string   `json:"detail"`
+	}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return SendResult{}, fmt.Errorf("fonnte: decode response: %w", err)
+	}
+	res := SendResult{OK: status < 300 && v.Status}
+	if len(v.ID) > 0 {
+		res.ID = v.ID[0]
+	}
+	if !res.OK {
+		res.Err = firstNonEmpty(v.Reason, v.Detail, snippet(body))
+	}
+	return res, nil
+}
+
+// wablasProvider posts a form with phone/message; the reply nests ids under data.messages.
+type wablasProvider struct{}
+
+func (wablasProvider) NewRequest(ctx context.Context, w *WhatsApp, to, text string) (*http.Request, error) {
+	form := url.Values{"phone": {to}, "message": {text}}
+	if strings.HasSuffix(to, "@g.us") {
+		form.Set("isGroup", "true")
+	}
+	req, err := formRequest(ctx, w.Endpoint, form)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", w.Token)
+	return req, nil
+}
+
+func (wablasProvider) ParseResponse(status int, body []byte) (SendResult, error) {
+	var v struct {
+		Status  bool   `json:"status"`
+		Message string `json:"message"`
+		Data    struct {
+			Messages []struct {
+				ID     string `json:"id"`
+				Status string `json:"status"`
+			} `json:"messages"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return SendResult{}, fmt.Errorf("wablas: decode response: %w", err)
+	}
+	res := SendResult{OK: status < 300 && v.Status}
+	if len(v.Data.Messages) > 0 {
+		m := v.Data.Messages[0]
+		res.ID = m.ID
+		if m.Status == "failed" || m.Status == "rejected" {
+			res.OK = false
+		}
+	}
+	if !res.OK {
+		res.Err = firstNonEmpty(v.Message, snippet(body))
+	}
+	return res, nil
+}
+
+// twilioProvider targets the Twilio Messages API (or anything compatible with it).
+// Endpoint is the API root, e.g. https://api.twilio.com.
+type twilioProvider struct{}
+
+func (twilioProvider) NewRequest(ctx context.Context, w *WhatsApp, to, text string) (*http.Request, error) {
+	if w.Account == "" || w.From == "" {
+		return nil, fmt.Errorf("twilio: account SID and sender number are required")
+	}
+	u := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", strings.TrimRight(w.Endpoint, "/"), url.PathEscape(w.Account))
+	form := url.Values{"To": {whatsappAddr(to)}, "From": {whatsappAddr(w.From)}, "Body": {text}}
+	req, err := formRequest(ctx, u, form)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(w.Account, w.Token)
+	return req, nil
+}
+
+func (twilioProvider) ParseResponse(status int, body []byte) (SendResult, error) {
+	var v struct {
+		SID          string `json:"sid"`
+		Status       any    `json:"status"` // the HTTP status number in error replies
+		ErrorCode    *int   `json:"error_code"`
+		ErrorMessage string `json:"error_message"`
+		Message      string `json:"message"` // error replies use {code, message}
+	}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return SendResult{}, fmt.Errorf("twilio: decode response: %w", err)
+	}
+	res := SendResult{ID: v.SID, OK: status < 300 && v.SID != "" && v.ErrorCode == nil}
+	if v.Status == "failed" || v.Status == "undelivered" {
+		res.OK = false
+	}
+	if !res.OK {
+		res.Err = firstNonEmpty(v.ErrorMessage, v.Message, snippet(body))
+	}
+	return res, nil
+}
+
+func whatsappAddr(n string) string {
+	if strings.HasPrefix(n, "whatsapp:") {
+		return n
+	}
+	return "whatsapp:" + n
+}
+
+func jsonRequest(ctx context.Context, u string, payload any) (*http.Request, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+func formRequest(ctx context.Context, u string, form url.Values) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+// statusFlag understands "status": true/false and "status": "success"/"error".
+func statusFlag(raw json.RawMessage) (ok, known bool) {
+	if len(raw) == 0 {
+		return false, false
+	}
+	var b bool
+	if json.Unmarshal(raw, &b) == nil {
+		return b, true
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		switch strings.ToLower(s) {
+		case "success", "ok", "sent", "true":
+			return true, true
+		case "error", "failed", "fail", "false":
+			return false, true
+		}
+	}
+	return false, false
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func snippet(b []byte) string {
+	s := strings.TrimSpace(string(b))
+	if len(s) > 200 {
+		s = s[:200] + "…"
+	}
+	return s
+}
@@ -0,0 +1,66 @@
+package notify
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Replies as recorded from each provider; failures include the HTTP 200
+// replies that only say so in the body.
+func TestProviderParseResponse(t *testing.T) {
+	tests := []struct {
+		provider string
+		name     string
+		status   int
+		body     string
+		wantOK   bool
+		wantID   string
+		wantErr  string // in SendResult.Err
+	}{
+		{provider: "gateway", name: "success", status: 200, body: `{"success": true, "messageId": "3EB0C431D2A1"}`, wantOK: true, wantID: "3EB0C431D2A1"},
+		{provider: "gateway", name: "plain text ok", status: 200, body: `OK`, wantOK: true},
+		{provider: "gateway", name: "200 status false", status: 200, body: `{"status": false, "message": "group not found"}`, wantErr: "group not found"},
+		{provider: "gateway", name: "200 status error", status: 200, body: `{"status": "error", "error": "not connected"}`, wantErr: "not connected"},
+		{provider: "gateway", name: "500 plain text", status: 500, body: `Internal Server Error`, wantErr: "Internal Server Error"},
+
+		{provider: "waha", name: "serialized id", status: 201, body: `{"id": {"fromMe": true, "remote": "120363@g.us", "id": "3EB0A1", "_serialized": "true_120363@g.us_3EB0A1"}, "body": "hi"}`, wantOK: true, wantID: "true_120363@g.us_3EB0A1"},
+		{provider: "waha", name: "string id", status: 201, body: `{"id": "true_120363@g.us_3EB0A1"}`, wantOK: true, wantID: "true_120363@g.us_3EB0A1"},
+		{provider: "waha", name: "200 without id", status: 200, body: `{}`, wantErr: "no message id"},
+		{provider: "waha", name: "session missing", status: 422, body: `{"statusCode": 422, "message": "Session \"default\" is not STARTED"}`, wantErr: "not STARTED"},
+
+		{provider: "fonnte", name: "queued", status: 200, body: `{"detail": "success! message in queue", "id": ["80367170"], "process": "pending", "status": true, "target": ["6281234567890"]}`, wantOK: true, wantID: "80367170"},
+		{provider: "fonnte", name: "200 status false", status: 200, body: `{"reason": "token invalid", "status": false}`, wantErr: "token invalid"},
+		{provider: "fonnte", name: "200 disconnected device", status: 200, body: `{"detail": "device disconnected", "status": false}`, wantErr: "device disconnected"},
+
+		{provider: "wablas", name: "pending", status: 200, body: `{"status": true, "message": "Message is pending and waiting to be processed", "data": {"device_id": "ABC", "quota": "unlimited", "messages": [{"id": "f3b5c1e0-7d5d", "phone": "6281234567890", "message": "hi", "status": "pending"}]}}`, wantOK: true, wantID: "f3b5c1e0-7d5d"},
+		{provider: "wablas", name: "200 status false", status: 200, body: `{"status": false, "message": "token invalid or device expired"}`, wantErr: "token invalid"},
+		{provider: "wablas", name: "message failed", status: 200, body: `{"status": true, "message": "sent", "data": {"messages": [{"id": "a1", "status": "failed"}]}}`, wantID: "a1", wantErr: "sent"},
+
+		{provider: "twilio", name: "queued", status: 201, body: `{"sid": "SM1f0e8ae6ade43cb3c0ce4525424e404f", "status": "queued", "error_code": null, "error_message": null}`, wantOK: true, wantID: "SM1f0e8ae6ade43cb3c0ce4525424e404f"},
+		{provider: "twilio", name: "invalid number", status: 400, body: `{"code": 21211, "message": "The 'To' number whatsapp:+62 is not a valid phone number.", "more_info": "https://www.twilio.com/docs/errors/21211", "status": 400}`, wantErr: "not a valid phone number"},
+		{provider: "twilio", name: "failed with error code", status: 201, body: `{"sid": "SM2", "status": "failed", "error_code": 63016, "error_message": "outside the allowed window"}`, wantID: "SM2", wantErr: "outside the allowed window"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider+"/"+tt.name, func(t *testing.T) {
+			res, err := providers[tt.provider].ParseResponse(tt.status, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("ParseResponse: %v", err)
+			}
+			if res.OK != tt.wantOK || res.ID != tt.wantID {
+				t.Errorf("ParseResponse = %+v; want OK %v, ID %q", res, tt.wantOK, tt.wantID)
+			}
+			if !strings.Contains(res.Err, tt.wantErr) || (tt.wantErr == "") != (res.Err == "") {
+				t.Errorf("Err = %q, want it to mention %q", res.Err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProviderParseResponseNotJSON(t *testing.T) {
+	for _, name := range []string{"waha", "fonnte", "wablas", "twilio"} {
+		if _, err := providers[name].ParseResponse(http.StatusOK, []byte(`<html>proxy</html>`)); err == nil {
+			t.Errorf("%s: an HTML 200 reply was accepted", name)
+		}
+	}
+}
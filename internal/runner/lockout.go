@@ -0,0 +1,96 @@
+package runner
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrLoginDisabled is returned instead of logging in after Moodle rejected
+// the credentials, so cron ticks do not run into the account lockout.
+var ErrLoginDisabled = errors.New("login disabled")
+
+// LoginLock records a login that needs a human: wrong credentials, a
+// locked account, an expired password or the wrong account. It is lifted
+// when USERNAME, PASSWORD or FULL_NAME change, or by UnlockLogin.
+type LoginLock struct {
+	Cause   string    `json:"cause"`
+	Message string    `json:"message,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// lockFile is LoginLock on disk. Salt and Sum identify the credentials
+// that failed without storing them; FULL_NAME is part of them because a
+// wrong_account lock is fixed by correcting it.
+type lockFile struct {
+	LoginLock
+	Salt string `json:"salt"`
+	Sum  string `json:"sum"`
+}
+
+func (l lockFile) matches(username, password, identity string) bool {
+	return l.Sum == credSum(l.Salt, username, password, identity)
+}
+
+func (l LoginLock) err() error {
+	return fmt.Errorf("%w after %s at %s: fix USERNAME/PASSWORD/FULL_NAME or run login-check -unlock",
+		ErrLoginDisabled, l.Cause, l.At.Format(time.RFC3339))
+}
+
+func credSum(salt, username, password, identity string) string {
+	sum := sha256.Sum256([]byte(salt + "\x00" + username + "\x00" + password + "\x00" + identity))
+	return hex.EncodeToString(sum[:])
+}
+
+// LoginLock returns the active lock, if any.
+func (r *Runner) LoginLock() (LoginLock, bool) {
+	l, ok := r.loginLock()
+	return l.LoginLock, ok
+}
+
+func (r *Runner) loginLock() (lockFile, bool) {
+	var l lockFile
+	if r.LoginLockPath == "" {
+		return l, false
+	}
+	b, err := os.ReadFile(r.LoginLockPath)
+	if err != nil {
+		return l, false
+	}
+	return l, json.Unmarshal(b, &l) == nil
+}
+
+// UnlockLogin lets the next run log in again.
+func (r *Runner) UnlockLogin() error {
+	if r.LoginLockPath == "" {
+		return nil
+	}
+	if err := os.Remove(r.LoginLockPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (r *Runner) lockLogin(cause, message, username, password, identity string) error {
+	if r.LoginLockPath == "" {
+		return nil
+	}
+	salt := make([]byte, 16)
+	_, _ = rand.Read(salt)
+	l := lockFile{LoginLock: LoginLock{Cause: cause, Message: message, At: time.Now()}, Salt: hex.EncodeToString(salt)}
+	l.Sum = credSum(l.Salt, username, password, identity)
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.LoginLockPath), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(r.LoginLockPath, b, 0o600)
+}
@@ -0,0 +1,143 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/emandor/gostudentubl/internal/breaker"
+	"github.com/emandor/gostudentubl/internal/httpx"
+	"github.com/emandor/gostudentubl/internal/metrics"
+	"github.com/emandor/gostudentubl/internal/moodle"
+	"github.com/emandor/gostudentubl/internal/notify"
+	"github.com/emandor/gostudentubl/internal/telemetry"
+)
+
+// outage reports whether err means Moodle is down, and whether it is
+// maintenance, which opens the breaker without waiting for repeats.
+func outage(err error) (down, maintenance bool) {
+	var lerr *moodle.LoginError
+	if errors.As(err, &lerr) && lerr.Cause == moodle.CauseMaintenance {
+		return true, true
+	}
+	var serr *httpx.StatusError
+	if errors.As(err, &serr) && serr.Code == http.StatusServiceUnavailable {
+		return true, true
+	}
+	return httpx.IsOutage(err), false
+}
+
+// siteDown reports whether err is an outage the breaker alerts on, so the
+// step that hit it does not raise an alert of its own.
+func (r *Runner) siteDown(err error) bool {
+	down, _ := outage(err)
+	return down && r.Breaker != nil
+}
+
+// admit checks the breaker before a run. When a probe is due it makes it,
+// and a good probe lets the run go ahead.
+func (r *Runner) admit(ctx context.Context) error {
+	if r.Breaker == nil {
+		return nil
+	}
+	ok, probe := r.Breaker.Allow(time.Now())
+	if !ok {
+		return fmt.Errorf("%w, next probe at %s", breaker.ErrOpen, r.Breaker.State().NextProbe.Format(time.RFC3339))
+	}
+	if probe {
+		return r.probe(ctx)
+	}
+	return nil
+}
+
+// trip feeds the outcome of a run to the breaker.
+func (r *Runner) trip(ctx context.Context, err error) {
+	if r.Breaker == nil || errors.Is(err, breaker.ErrOpen) || errors.Is(err, context.Canceled) {
+		return
+	}
+	log := telemetry.Ctx(ctx, r.Log)
+	down, maintenance := outage(err)
+	if !down {
+		// Moodle answered, whatever it said
+		r.closeBreaker(ctx)
+		return
+	}
+	opened, serr := r.Breaker.Failure(time.Now(), err.Error(), maintenance)
+	if serr != nil {
+		log.Warn().Err(serr).Msg("saving breaker state")
+	}
+	if opened {
+		st := r.Breaker.State()
+		metrics.BreakerOpen.Set(1)
+		log.Warn().Str("reason", st.Reason).Time("next_probe", st.NextProbe).Msg("🚧 e-learning unavailable, breaker open")
+		r.raise(ctx, "outage", notify.EventSiteDown, nil, st.Reason)
+	}
+}
+
+// Probe checks the site with a single request if the breaker is open and a
+// probe is due; a good answer closes the breaker. It shares the run lock,
+// so it never races the probe admit makes for a run; while one is active
+// it does nothing.
+func (r *Runner) Probe(ctx context.Context) error {
+	if r.Breaker == nil {
+		return nil
+	}
+	if !r.mu.TryLock() {
+		return nil
+	}
+	defer r.mu.Unlock()
+	if _, due := r.Breaker.Allow(time.Now()); !due {
+		return nil
+	}
+	return r.probe(ctx)
+}
+
+func (r *Runner) probe(ctx context.Context) error {
+	log := telemetry.Ctx(ctx, r.Log)
+	if err := r.M.Ping(ctx); err != nil {
+		if _, serr := r.Breaker.Failure(time.Now(), err.Error(), false); serr != nil {
+			log.Warn().Err(serr).Msg("saving breaker state")
+		}
+		log.Info().Err(err).Time("next_probe", r.Breaker.State().NextProbe).Msg("🚧 probe failed, breaker stays open")
+		return fmt.Errorf("%w: probe: %w", breaker.ErrOpen, err)
+	}
+	r.closeBreaker(ctx)
+	return nil
+}
+
+func (r *Runner) closeBreaker(ctx context.Context) {
+	closed, err := r.Breaker.Success()
+	if err != nil {
+		telemetry.Ctx(ctx, r.Log).Warn().Err(err).Msg("saving breaker state")
+	}
+	if closed {
+		metrics.BreakerOpen.Set(0)
+		telemetry.Ctx(ctx, r.Log).Info().Msg("✅ e-learning reachable again, breaker closed")
+		r.clear(ctx, "outage")
+	}
+}
+
+// WatchBreaker probes between scheduled runs while the breaker is open,
+// so the first run after an outage does not wait for the next probe.
+func (r *Runner) WatchBreaker(ctx context.Context) {
+	if r.Breaker == nil {
+		return
+	}
+	if r.Breaker.State().Open {
+		metrics.BreakerOpen.Set(1)
+	}
+	t := time.NewTicker(time.Minute)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			pctx, cancel := context.WithTimeout(ctx, time.Minute)
+			_ = r.Probe(pctx)
+			cancel()
+		}
+	}
+}
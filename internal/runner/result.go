@@ -0,0 +1,335 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/emandor/gostudentubl/internal/breaker"
+	"github.com/emandor/gostudentubl/internal/config"
+	"github.com/emandor/gostudentubl/internal/filelock"
+	"github.com/emandor/gostudentubl/internal/history"
+	"github.com/emandor/gostudentubl/internal/httpx"
+	"github.com/emandor/gostudentubl/internal/metrics"
+	"github.com/emandor/gostudentubl/internal/moodle"
+	"github.com/emandor/gostudentubl/internal/notify"
+	"github.com/emandor/gostudentubl/internal/telemetry"
+)
+
+// ErrBusy is returned when a run is requested while another is in
+// progress, in this process or, with RunLockPath, in another one.
+var ErrBusy = errors.New("a run is already in progress")
+
+// RunResult summarises one attendance run.
+type RunResult struct {
+	ID          string    `json:"id"` // run_id in the logs
+	Started     time.Time `json:"started"`
+	Finished    time.Time `json:"finished"`
+	Attendances int       `json:"attendances"`
+	Submitted   int       `json:"submitted"`
+	Failed      int       `json:"failed"`
+	Err         string    `json:"error,omitempty"`
+}
+
+func (res RunResult) Duration() time.Duration { return res.Finished.Sub(res.Started) }
+
+// LoginStatus is the outcome of the most recent login attempt.
+type LoginStatus struct {
+	OK  bool      `json:"ok"`
+	At  time.Time `json:"at"`
+	Err string    `json:"error,omitempty"`
+}
+
+// RunAttendance is the scheduled entry point, see Run.
+func (r *Runner) RunAttendance(ctx context.Context) error {
+	_, err := r.Run(ctx)
+	if errors.Is(err, breaker.ErrOpen) {
+		// expected while Moodle is down, the alert went out when it opened
+		telemetry.Ctx(ctx, r.Log).Info().Err(err).Msg("🚧 run skipped")
+		return nil
+	}
+	return err
+}
+
+// Run logs in, finds open sessions and submits them. Only one run happens
+// at a time, across processes sharing RunLockPath; a concurrent call
+// returns ErrBusy straight away. While the
+// Breaker is open it returns breaker.ErrOpen without touching Moodle.
+func (r *Runner) Run(ctx context.Context) (RunResult, error) {
+	unlock, err := r.lockRun()
+	if err != nil {
+		return RunResult{}, err
+	}
+	defer unlock()
+
+	id := telemetry.NewRunID()
+	ctx = telemetry.WithRunID(ctx, r.Log, id)
+	ctx, span := telemetry.Tracer().Start(ctx, "run", trace.WithAttributes(attribute.String("run.id", id)))
+	defer span.End()
+
+	if err := r.admit(ctx); err != nil {
+		telemetry.Fail(span, err)
+		metrics.Runs.WithLabelValues("skipped").Inc()
+		now := time.Now()
+		return RunResult{ID: id, Started: now, Finished: now, Err: err.Error()}, err
+	}
+
+	ctx = httpx.WithBudget(ctx, r.MaxRequests)
+	res := &RunResult{ID: id, Started: time.Now()}
+	r.stateMu.Lock()
+	r.current = res
+	r.stateMu.Unlock()
+
+	err = r.run(ctx, res)
+	r.trip(ctx, err)
+	if n, waited, ok := httpx.Usage(ctx); ok {
+		telemetry.Ctx(ctx, r.Log).Info().Int("requests", n).Int("max_requests", r.MaxRequests).Dur("rate_wait", waited).Msg("📶 run requests")
+	}
+
+	r.stateMu.Lock()
+	res.Finished = time.Now()
+	if err != nil {
+		res.Err = err.Error()
+	}
+	r.current, r.last = nil, res
+	out := *res
+	r.stateMu.Unlock()
+
+	outcome := "ok"
+	switch {
+	case err != nil:
+		outcome = "error"
+	case out.Failed > 0:
+		outcome = "partial"
+	}
+	span.SetAttributes(
+		attribute.String("outcome", outcome),
+		attribute.Int("attendances", out.Attendances),
+		attribute.Int("submitted", out.Submitted),
+		attribute.Int("failed", out.Failed),
+	)
+	telemetry.Fail(span, err)
+	metrics.Runs.WithLabelValues(outcome).Inc()
+	metrics.RunDuration.WithLabelValues(outcome).Observe(out.Duration().Seconds())
+	return out, err
+}
+
+// LastResult returns the most recent finished run, if any.
+func (r *Runner) LastResult() (RunResult, bool) {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+	if r.last == nil {
+		return RunResult{}, false
+	}
+	return *r.last, true
+}
+
+// Idle waits until no run, course listing or startup login holds the run
+// lock, or ctx is done. The daemon calls it on shutdown after cancelling
+// the runs it started.
+func (r *Runner) Idle(ctx context.Context) error {
+	t := time.NewTicker(100 * time.Millisecond)
+	defer t.Stop()
+	for !r.mu.TryLock() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+// Running reports whether a run is in progress.
+func (r *Runner) Running() bool {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+	return r.current != nil
+}
+
+func (r *Runner) count(kind history.Kind) {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+	if r.current == nil {
+		return
+	}
+	switch kind {
+	case history.KindSubmitted:
+		r.current.Submitted++
+	case history.KindFailed:
+		r.current.Failed++
+	}
+}
+
+// Courses logs in and lists the courses of the current periode. It shares
+// the run lock, so it returns ErrBusy instead of logging in underneath a
+// run that is using the session.
+func (r *Runner) Courses(ctx context.Context) ([]moodle.Course, error) {
+	unlock, err := r.lockRun()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := r.Login(ctx); err != nil {
+		return nil, err
+	}
+	courses, err := r.M.GetCourses(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("courses: %w", err)
+	}
+	var out []moodle.Course
+	for _, c := range courses {
+		if r.CurrentPeriode == "" || c.Periode == r.CurrentPeriode {
+			out = append(out, c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CourseName < out[j].CourseName })
+	return out, nil
+}
+
+// Login signs in with the credentials from the config. The first call
+// tries the session saved in the vault and skips the login if it is
+// still valid.
+func (r *Runner) Login(ctx context.Context) error {
+	err := r.login(ctx)
+	st := LoginStatus{OK: err == nil, At: time.Now()}
+	if err != nil {
+		st.Err = err.Error()
+	}
+	r.stateMu.Lock()
+	r.lastLogin = st
+	r.stateMu.Unlock()
+	return err
+}
+
+// WarmUp logs in once so readiness does not have to wait for the first
+// job. It does nothing when a run already holds the lock or a login has
+// been attempted since start.
+func (r *Runner) WarmUp(ctx context.Context) error {
+	unlock, err := r.lockRun()
+	if errors.Is(err, ErrBusy) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if !r.LastLogin().At.IsZero() {
+		return nil
+	}
+	return r.Login(ctx)
+}
+
+// lockRun takes the run lock without waiting: mu and, with RunLockPath,
+// the file lock other processes take. ErrBusy when either is held.
+func (r *Runner) lockRun() (func(), error) {
+	if !r.mu.TryLock() {
+		return nil, ErrBusy
+	}
+	if r.RunLockPath == "" {
+		return r.mu.Unlock, nil
+	}
+	unlock, ok, err := filelock.TryLock(r.RunLockPath)
+	if err != nil || !ok {
+		r.mu.Unlock()
+		if err != nil {
+			return nil, fmt.Errorf("run lock: %w", err)
+		}
+		return nil, ErrBusy
+	}
+	return func() {
+		unlock()
+		r.mu.Unlock()
+	}, nil
+}
+
+// LastLogin returns the outcome of the latest login; zero At means none yet.
+func (r *Runner) LastLogin() LoginStatus {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+	return r.lastLogin
+}
+
+func (r *Runner) login(ctx context.Context) error {
+	if r.Vault != nil {
+		resumed := false
+		r.restore.Do(func() {
+			r.M.SetCookies(r.Vault.Cookies())
+			resumed, _ = r.M.LoggedIn(ctx)
+		})
+		if resumed {
+			telemetry.Ctx(ctx, r.Log).Info().Msg("🍪 resumed saved session")
+			return nil
+		}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if lock, ok := r.loginLock(); ok {
+		if lock.matches(cfg.Username, cfg.Password, cfg.FullName) {
+			return lock.err()
+		}
+		telemetry.Ctx(ctx, r.Log).Info().Str("cause", lock.Cause).Msg("🔓 credentials changed, trying to log in again")
+		if err := r.UnlockLogin(); err != nil {
+			return err
+		}
+	}
+	if err := r.M.Login(ctx /* env */, cfg.Username, cfg.Password); err != nil {
+		var lerr *moodle.LoginError
+		if errors.As(err, &lerr) && lerr.Permanent() {
+			if err := r.lockLogin(string(lerr.Cause), lerr.Message, cfg.Username, cfg.Password, cfg.FullName); err != nil {
+				telemetry.Ctx(ctx, r.Log).Warn().Err(err).Msg("saving login lock")
+			}
+			telemetry.Ctx(ctx, r.Log).Error().Str("cause", string(lerr.Cause)).Msg("🔒 logins disabled until the credentials change or login-check -unlock")
+		}
+		return fmt.Errorf("login: %w", err)
+	}
+	if r.Vault != nil {
+		if err := r.Vault.SaveCookies(r.M.Cookies()); err != nil {
+			telemetry.Ctx(ctx, r.Log).Warn().Err(err).Msg("saving session to vault")
+		}
+	}
+	return nil
+}
+
+var errNoCourses = errors.New("courses: none parsed")
+
+// raise reports a failure once per key until clear is called for it.
+func (r *Runner) raise(ctx context.Context, key string, t notify.EventType, a *moodle.Attendance, detail string) {
+	if r.Alerts == nil {
+		return
+	}
+	ev := notify.Event{Type: t, Detail: detail, At: time.Now().In(r.Notify.Location())}
+	if a != nil {
+		ev.Course = a.Course.CourseName
+		ev.CourseID = a.Course.CourseID
+		ev.Attendance = a.AttendanceName
+		ev.Link = a.AttendanceLink
+	}
+	sent, err := r.Alerts.Fail(ctx, key, ev)
+	if err != nil {
+		telemetry.Ctx(ctx, r.Log).Warn().Err(err).Str("alert", key).Msg("alerts")
+	}
+	if sent {
+		telemetry.Ctx(ctx, r.Log).Info().Str("alert", key).Msg("🚨 alert raised")
+	}
+}
+
+// clear sends a recovery message if key had an open alert.
+func (r *Runner) clear(ctx context.Context, key string) {
+	if r.Alerts == nil {
+		return
+	}
+	if err := r.Alerts.Resolve(ctx, key, time.Now().In(r.Notify.Location())); err != nil {
+		telemetry.Ctx(ctx, r.Log).Warn().Err(err).Str("alert", key).Msg("alerts")
+	}
+}
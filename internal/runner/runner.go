@@ -2,118 +2,437 @@ package runner
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
-	"golang.org/x/time/rate"
 
-	"github.com/emandor/gostudentubl/internal/config"
+	"github.com/emandor/gostudentubl/internal/audit"
+	"github.com/emandor/gostudentubl/internal/breaker"
+	"github.com/emandor/gostudentubl/internal/history"
+	"github.com/emandor/gostudentubl/internal/httpx"
+	"github.com/emandor/gostudentubl/internal/metrics"
 	"github.com/emandor/gostudentubl/internal/moodle"
 	"github.com/emandor/gostudentubl/internal/notify"
+	"github.com/emandor/gostudentubl/internal/secrets"
+	"github.com/emandor/gostudentubl/internal/telemetry"
 )
 
 type Runner struct {
+	mu        sync.Mutex // held for the whole run, see lockRun
+	stateMu   sync.Mutex
+	last      *RunResult
+	current   *RunResult
+	lastLogin LoginStatus
+
 	Log            zerolog.Logger
 	M              *moodle.Client
 	Dry            bool
 	Conc           int
 	CurrentPeriode string
-	Limiter        *rate.Limiter
+	MaxRequests    int // per run, 0 for no cap; see httpx.WithBudget
+	Notify         *notify.Notifier
+	History        *history.Store
+	DigestPeriod   string // day or week
+	Alerts         *notify.Alerter
+	// Vault persists the Moodle session cookies across restarts; optional.
+	Vault *secrets.Vault
+	Audit *audit.Log // submission evidence; optional
+	// LoginLockPath keeps logins off after a permanent failure, see LoginLock.
+	LoginLockPath string
+	// Breaker skips runs while Moodle is down; optional.
+	Breaker *breaker.Breaker
+	// RunLockPath extends the run lock to other processes, so a one-shot
+	// command and the daemon never use Moodle at once; empty keeps it in
+	// this process.
+	RunLockPath string
+	restore     sync.Once
 }
 
-func (r *Runner) RunAttendance(ctx context.Context) error {
-	cfg, err := config.Load()
-	username := cfg.Username
-	password := cfg.Password
-	waMe := cfg.WAMe
-	waGroup := cfg.WaGroup
-	if err := r.M.Login(ctx /* env */, username, password); err != nil {
-		return fmt.Errorf("login: %w", err)
+func (r *Runner) run(ctx context.Context, res *RunResult) error {
+	log := telemetry.Ctx(ctx, r.Log)
+	if r.M.Fingerprints != nil {
+		r.M.Fingerprints.Begin()
+	}
+	// also after an early return, the pages fetched until then count
+	defer r.drift(ctx)
+	if err := r.step(ctx, "login", r.Login); err != nil {
+		if !r.siteDown(err) {
+			r.raise(ctx, "login", notify.EventLoginError, nil, err.Error())
+		}
+		return err
 	}
-	courses, err := r.M.GetCourses(ctx)
+	r.clear(ctx, "login")
 
+	var courses []moodle.Course
+	err := r.step(ctx, "courses", func(ctx context.Context) (err error) {
+		courses, err = r.M.GetCourses(ctx)
+		return err
+	})
 	if err != nil {
+		if !r.siteDown(err) {
+			r.raise(ctx, "courses", notify.EventFailed, nil, "courses: "+err.Error())
+		}
 		return fmt.Errorf("courses: %w", err)
 	}
+	if len(courses) == 0 {
+		// the overview always lists enrolled courses, an empty parse means the page changed
+		r.raise(ctx, "courses", notify.EventMarkupChanged, nil, "no course could be parsed from the grade overview page")
+		return errNoCourses
+	}
+	r.clear(ctx, "courses")
 
 	// Group/filter by current periode if desired (simple example keeps all)
 	sort.Slice(courses, func(i, j int) bool { return courses[i].CourseName < courses[j].CourseName })
 
 	currentPeriode := r.CurrentPeriode
 	var all []moodle.Attendance
+	listed, listFailed := 0, 0
+	var listErr error
 	for _, c := range courses {
-		// log some info about the course
-		r.Log.Info().Str("course", c.CourseName).Msg("fetching attendance list")
-		ats, err := r.M.GetAttendance(ctx, c)
-		if err != nil {
-			r.Log.Warn().Err(err).Str("course", c.CourseName).Msg("attendance list")
+		if c.Periode != currentPeriode {
+			log.Info().Str("course", c.CourseName).Str("periode", c.Periode).Msg("skipping not current periode")
+			log.Info().Msgf("current periode is %q", currentPeriode)
 			continue
 		}
-
-		if c.Periode != currentPeriode {
-			r.Log.Info().Str("course", c.CourseName).Str("periode", c.Periode).Msg("skipping not current periode")
-			r.Log.Info().Msgf("current periode is %q", currentPeriode)
+		// log some info about the course
+		log.Info().Str("course", c.CourseName).Msg("fetching attendance list")
+		listed++
+		var ats []moodle.Attendance
+		err := r.step(ctx, "attendance_list", func(ctx context.Context) (err error) {
+			ats, err = r.M.GetAttendance(ctx, c)
+			return err
+		}, attribute.String("course", c.CourseName), attribute.Int("course.id", c.CourseID))
+		if err != nil {
+			log.Warn().Err(err).Str("course", c.CourseName).Msg("attendance list")
+			listFailed, listErr = listFailed+1, err
 			continue
 		}
 		for _, a := range ats {
 			all = append(all, a)
 		}
 	}
+	if listed > 0 && listFailed == listed {
+		r.raise(ctx, "attendance_list", notify.EventFailed, nil, "every attendance list failed: "+listErr.Error())
+	} else {
+		r.clear(ctx, "attendance_list")
+	}
+	res.Attendances = len(all)
 	if len(all) == 0 {
-		r.Log.Info().Msg("no attendance found")
+		log.Info().Msg("no attendance found")
 		return nil
 	}
 
-	g, ctx := errgroup.WithContext(ctx)
+	// one combined message per recipient once every attendance is done
+	batch := r.Notify.NewBatch(ctx)
+	defer func() {
+		if err := batch.Flush(); err != nil {
+			log.Warn().Err(err).Msg("notify")
+		}
+	}()
+
+	var mu sync.Mutex
+	fetched := 0      // view pages Moodle answered with
+	unrecognized := 0 // of those, pages with neither a submit link nor a session log
+	var viewErr, fetchErr error
+	failed := map[string]bool{}
+	fail := func(ctx context.Context, a moodle.Attendance, detail string) {
+		r.record(ctx, a, history.KindFailed, detail)
+		mu.Lock()
+		failed["submit:"+a.AttendanceID] = true
+		mu.Unlock()
+		r.raise(ctx, "submit:"+a.AttendanceID, notify.EventFailed, &a, detail)
+	}
+
+	// gctx ends with g.Wait, the alerts after it go out on ctx
+	g, gctx := errgroup.WithContext(ctx)
 	g.SetLimit(max(5, r.Conc))
 	for i := range all {
 		a := all[i]
 		g.Go(func() error {
-			if err := r.Limiter.Wait(ctx); err != nil {
+			ctx, span := telemetry.Tracer().Start(gctx, "attendance", trace.WithAttributes(attendanceAttrs(a)...))
+			defer span.End()
+			ctx = telemetry.WithSubID(ctx, a.AttendanceID)
+			log := telemetry.Ctx(ctx, r.Log)
+			var vi moodle.ViewInfo
+			err := r.step(ctx, "view", func(ctx context.Context) (err error) {
+				vi, err = r.M.ViewAttendanceByID(ctx, a.AttendanceID)
 				return err
+			})
+			r.saveSessions(ctx, a, vi.Sessions)
+			mu.Lock()
+			switch {
+			case errors.Is(err, moodle.ErrNoSubmitLink):
+				fetched++
+				if len(vi.Sessions) == 0 {
+					unrecognized, viewErr = unrecognized+1, err
+				}
+			case err != nil:
+				// not the parser's fault: network, outage, expired session
+				fetchErr = err
+			default:
+				fetched++
 			}
-			vi, err := r.M.ViewAttendanceByID(ctx, a.AttendanceID)
+			mu.Unlock()
 			if err != nil {
-				r.Log.Warn().Err(err).Str("att", a.AttendanceName).Msg("view")
+				log.Warn().Err(err).Str("att", a.AttendanceName).Msg("view")
 				return nil
 			}
 			if r.Dry {
-				r.Log.Info().Str("att", a.AttendanceName).Msg("dry-run skip submit")
+				log.Info().Str("att", a.AttendanceName).Msg("dry-run skip submit")
 				return nil
 			}
-			fi, err := r.M.GetFormInfo(ctx, vi.SubmitLink, vi.SessionID, vi.SessKey)
+			var fi moodle.FormInfo
+			err = r.step(ctx, "form", func(ctx context.Context) (err error) {
+				fi, err = r.M.GetFormInfo(ctx, vi.SubmitLink, vi.SessionID, vi.SessKey)
+				return err
+			})
 			if err != nil {
-				r.Log.Warn().Err(err).Str("att", a.AttendanceName).Msg("form")
+				log.Warn().Err(err).Str("att", a.AttendanceName).Msg("form")
+				fail(ctx, a, "form: "+err.Error())
 				return nil
 			}
-			if err := r.M.SubmitAttendance(ctx, r.M.Base.AttendanceFormURL, fi); err != nil {
-				r.Log.Warn().Err(err).Str("att", a.AttendanceName).Msg("submit")
+			// the row the submission has to show up in
+			before, ok := vi.Session(vi.SessionID)
+			if !ok {
+				before = moodle.Session{SessID: vi.SessionID}
+			}
+			var sub moodle.Submission
+			err = r.step(ctx, "submit", func(ctx context.Context) (err error) {
+				sub, err = r.submit(ctx, a, fi, before)
+				return err
+			})
+			if err != nil {
+				r.audit(ctx, a, fi, sub, audit.OutcomeError, moodle.Session{}, err)
+				log.Warn().Err(err).Str("att", a.AttendanceName).Msg("submit")
+				fail(ctx, a, "submit: "+err.Error())
 				return nil
 			}
-			done, err := r.M.CheckSubmitted(ctx, a.AttendanceID)
+			var row moodle.Session
+			var done bool
+			err = r.step(ctx, "verify", func(ctx context.Context) (err error) {
+				row, done, err = r.M.CheckSubmitted(ctx, a.AttendanceID, before)
+				return err
+			})
 			if err != nil {
-				r.Log.Warn().Err(err).Str("att", a.AttendanceName).Msg("check")
+				r.audit(ctx, a, fi, sub, audit.OutcomeError, moodle.Session{}, fmt.Errorf("check: %w", err))
+				log.Warn().Err(err).Str("att", a.AttendanceName).Msg("check")
+				fail(ctx, a, "check: "+err.Error())
 				return nil
 			}
 			if done {
-				t := time.Now().Format(time.RFC3339)
+				r.audit(ctx, a, fi, sub, audit.OutcomeConfirmed, row, nil)
+				at := time.Now().In(r.Notify.Location())
 				courseName := a.Course.CourseName
-				r.Log.Info().Str("at", t).Str("course", courseName).Str("att", a.AttendanceName).Msg("✅ attendance submitted")
+				log.Info().Str("at", at.Format(time.RFC3339)).Str("course", courseName).Str("att", a.AttendanceName).Msg("✅ attendance submitted")
+				r.record(ctx, a, history.KindSubmitted, "")
+				r.clear(ctx, "submit:"+a.AttendanceID)
 				// need send notification with link
-				messageToMe := fmt.Sprintf("✅ Presensi sukses!\n\nMata Kuliah: %s\nPresensi: %s\nJam: %s\nLink: %s", courseName, a.AttendanceName, t, a.AttendanceLink)
-				messageToGroup := fmt.Sprintf("🤖 Absen Sodara ☕️\n\nMata Kuliah: %s\nPresensi: %s\nJam: %s\nLink: %s", courseName, a.AttendanceName, t, a.AttendanceLink)
-
-				notify.SendWhatsAppConcurrent([]notify.GroupMessage{
-					{Message: messageToMe, GroupID: waMe},
-					{Message: messageToGroup, GroupID: waGroup},
+				batch.Add(notify.Event{
+					Type:       notify.EventSubmitted,
+					Course:     courseName,
+					CourseID:   a.Course.CourseID,
+					Attendance: a.AttendanceName,
+					Link:       a.AttendanceLink,
+					At:         at,
 				})
 				return nil
 			}
+			r.audit(ctx, a, fi, sub, audit.OutcomeUnconfirmed, row, nil)
+			fail(ctx, a, "submission not confirmed")
+			span.SetStatus(codes.Error, "submission not confirmed")
 			return nil
 		})
 	}
-	return g.Wait()
+	err = g.Wait()
+
+	switch {
+	case fetched == 0:
+		// nothing to judge the markup by; an outage goes to the breaker
+		// through the run's error
+		if !r.siteDown(fetchErr) && !errors.Is(fetchErr, context.Canceled) {
+			r.raise(ctx, "view_fetch", notify.EventFailed, nil, "every attendance view failed: "+fetchErr.Error())
+		}
+		if err == nil {
+			err = fmt.Errorf("view: %w", fetchErr)
+		}
+	case unrecognized == fetched:
+		r.clear(ctx, "view_fetch")
+		r.raise(ctx, "view", notify.EventMarkupChanged, nil, "no attendance view page had a submit link or session log, last error: "+viewErr.Error())
+	default:
+		r.clear(ctx, "view_fetch")
+		r.clear(ctx, "view")
+	}
+	// sessions that closed while failing did not recover, they just went away
+	if r.Alerts != nil && err == nil {
+		if ferr := r.Alerts.Forget("submit:", failed); ferr != nil {
+			log.Warn().Err(ferr).Msg("alerts")
+		}
+	}
+	return err
+}
+
+// submit sends the form. A failed POST is only sent again, with retries,
+// once the view page shows the session's own row, before, still not
+// self-recorded; that first attempt is audited here, the caller audits the
+// one returned.
+func (r *Runner) submit(ctx context.Context, a moodle.Attendance, fi moodle.FormInfo, before moodle.Session) (moodle.Submission, error) {
+	sub, err := r.M.SubmitAttendance(ctx, r.M.Base.AttendanceFormURL, fi)
+	// an expired session also voids the sesskey in fi, resending cannot work
+	if err == nil || ctx.Err() != nil || errors.Is(err, moodle.ErrSessionExpired) {
+		return sub, err
+	}
+	log := telemetry.Ctx(ctx, r.Log).With().Str("att", a.AttendanceName).Logger()
+	row, landed, verr := r.M.CheckSubmitted(ctx, a.AttendanceID, before)
+	switch {
+	case verr != nil:
+		return sub, fmt.Errorf("%w (not retried, check failed: %v)", err, verr)
+	case landed:
+		log.Info().Err(err).Msg("submit failed but the attendance was recorded")
+		return sub, nil
+	}
+	r.audit(ctx, a, fi, sub, audit.OutcomeError, row, fmt.Errorf("%w (not recorded on check, resending)", err))
+	log.Warn().Err(err).Msg("🔁 submission not recorded, retrying")
+	return r.M.SubmitAttendance(httpx.RetryUnsafe(ctx), r.M.Base.AttendanceFormURL, fi)
+}
+
+// drift warns about page types whose markup lost selectors the parsers use
+// on every page of the type this run, see moodle.Client.Fingerprints.
+func (r *Runner) drift(ctx context.Context) {
+	if r.M.Fingerprints == nil {
+		return
+	}
+	for page, missing := range r.M.Fingerprints.Drift() {
+		if len(missing) == 0 {
+			r.clear(ctx, "markup:"+page)
+			continue
+		}
+		r.raise(ctx, "markup:"+page, notify.EventMarkupChanged, nil,
+			fmt.Sprintf("%s page: selectors no longer match: %s", page, strings.Join(missing, ", ")))
+	}
+}
+
+// step runs fn in a child span named name, recording its error.
+func (r *Runner) step(ctx context.Context, name string, fn func(ctx context.Context) error, attrs ...attribute.KeyValue) error {
+	ctx, span := telemetry.Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+	defer span.End()
+	err := fn(ctx)
+	telemetry.Fail(span, err)
+	return err
+}
+
+func attendanceAttrs(a moodle.Attendance) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("course", a.Course.CourseName),
+		attribute.Int("course.id", a.Course.CourseID),
+		attribute.String("attendance", a.AttendanceName),
+		attribute.String("attendance.id", a.AttendanceID),
+	}
+}
+
+// RunDigest sends the attendance summary for the configured period.
+func (r *Runner) RunDigest(ctx context.Context) error {
+	if r.History == nil {
+		return fmt.Errorf("digest: no history store")
+	}
+	now := time.Now().In(r.Notify.Location())
+	sum, err := r.History.Summarise(r.DigestPeriod, now)
+	if err != nil {
+		return fmt.Errorf("digest: %w", err)
+	}
+	_, err = r.Notify.Notify(ctx, notify.Event{Type: notify.EventDigest, At: now, Digest: &sum})
+	return err
+}
+
+func (r *Runner) record(ctx context.Context, a moodle.Attendance, kind history.Kind, detail string) {
+	r.count(kind)
+	metrics.Attendance.WithLabelValues(a.Course.CourseName, string(kind)).Inc()
+	if r.History == nil {
+		return
+	}
+	err := r.History.Append(history.Record{
+		At:           time.Now().In(r.Notify.Location()),
+		Kind:         kind,
+		CourseID:     a.Course.CourseID,
+		Course:       a.Course.CourseName,
+		AttendanceID: a.AttendanceID,
+		Attendance:   a.AttendanceName,
+		Link:         a.AttendanceLink,
+		Detail:       detail,
+	})
+	if err != nil {
+		telemetry.Ctx(ctx, r.Log).Warn().Err(err).Msg("history")
+	}
+}
+
+// audit appends the submission attempt and its confirmation page to the
+// audit trail; row is the session log row the check judged it by, zero
+// when there was no check.
+func (r *Runner) audit(ctx context.Context, a moodle.Attendance, fi moodle.FormInfo, sub moodle.Submission, outcome string, row moodle.Session, err error) {
+	if r.Audit == nil {
+		return
+	}
+	e := audit.Entry{
+		RunID:        telemetry.RunID(ctx),
+		SessionID:    fi.SessID,
+		AttendanceID: a.AttendanceID,
+		Attendance:   a.AttendanceName,
+		CourseID:     a.Course.CourseID,
+		Course:       a.Course.CourseName,
+		Status:       fi.Status,
+		RequestAt:    sub.RequestAt,
+		ResponseAt:   sub.ResponseAt,
+		HTTPStatus:   sub.StatusCode,
+		Outcome:      outcome,
+	}
+	if row.Date != "" {
+		e.SessionRow = row.Date + ": " + row.Status
+		if row.SelfRecorded {
+			e.SessionRow += " (self-recorded)"
+		}
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if aerr := r.Audit.Append(e, sub.Page); aerr != nil {
+		telemetry.Ctx(ctx, r.Log).Error().Err(aerr).Msg("audit")
+	}
+}
+
+func (r *Runner) saveSessions(ctx context.Context, a moodle.Attendance, ss []moodle.Session) {
+	if r.History == nil || len(ss) == 0 {
+		return
+	}
+	out := make([]history.Session, 0, len(ss))
+	for _, s := range ss {
+		hs := history.Session{
+			CourseID:     a.Course.CourseID,
+			Course:       a.Course.CourseName,
+			AttendanceID: a.AttendanceID,
+			Attendance:   a.AttendanceName,
+			Link:         a.AttendanceLink,
+			Date:         s.Date,
+			Description:  s.Description,
+			Status:       s.Status,
+			Earned:       s.Earned,
+			Max:          s.Max,
+			Taken:        s.Taken,
+		}
+		if !s.At.IsZero() {
+			at := s.At
+			hs.At = &at
+		}
+		out = append(out, hs)
+	}
+	if err := r.History.PutSessions(a.AttendanceID, out); err != nil {
+		telemetry.Ctx(ctx, r.Log).Warn().Err(err).Msg("history sessions")
+	}
 }
@@ -0,0 +1,273 @@
+package runner
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/emandor/gostudentubl/internal/audit"
+	"github.com/emandor/gostudentubl/internal/breaker"
+	"github.com/emandor/gostudentubl/internal/filelock"
+	"github.com/emandor/gostudentubl/internal/httpx"
+	"github.com/emandor/gostudentubl/internal/moodle"
+	"github.com/emandor/gostudentubl/internal/notify"
+)
+
+// fakeMoodle serves a logged-in student with one course and one
+// attendance (id 7) whose view page is view, or sessionLog when view is
+// empty. Each submit answers with the next of replies (200 once they run
+// out); a 200 records the session unless ignore is set.
+type fakeMoodle struct {
+	mu       sync.Mutex
+	view     string
+	replies  []int
+	ignore   bool
+	posts    int
+	recorded bool
+}
+
+func (f *fakeMoodle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	page := ""
+	switch r.URL.Path {
+	case "/login/index.php":
+		page = `<form><input name="logintoken" value="tok"></form>`
+		if r.Method == http.MethodPost {
+			page = `<p>Dashboard</p>`
+		}
+	case "/grade/report/overview/index.php":
+		page = `<table id="overview-grade"><tbody><tr><td class="cell c0"><a href="/course/user.php?id=11">Basis Data-2025-A1</a></td><td class="cell c1">80</td></tr></tbody></table>`
+	case "/mod/attendance/index.php":
+		page = `<table class="generaltable"><tbody><tr><td class="cell c0">Presensi</td><td class="cell c1"><a href="/mod/attendance/view.php?id=7">Presensi Pertemuan</a></td></tr></tbody></table>`
+	case "/mod/attendance/view.php":
+		page = f.view
+		if page == "" {
+			page = sessionLog("http://"+r.Host, f.recorded)
+		}
+	case "/mod/attendance/attendance.php":
+		if r.Method == http.MethodGet {
+			page = `<form><input name="sessid" value="55"><input name="sesskey" value="abc"><input name="status" value="1"></form>`
+			break
+		}
+		f.posts++
+		status := http.StatusOK
+		if len(f.replies) > 0 {
+			status, f.replies = f.replies[0], f.replies[1:]
+		}
+		if status == http.StatusOK && !f.ignore {
+			f.recorded = true
+		}
+		w.WriteHeader(status)
+		page = `<p>Saved</p>`
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	fmt.Fprintf(w, "<html><body>%s</body></html>", page)
+}
+
+// sessionLog is a view page with an earlier self-recorded session and
+// session 55, open or, once recorded, self-recorded too.
+func sessionLog(base string, recorded bool) string {
+	open := `<td class="statuscol"><a href="` + base + `/mod/attendance/attendance.php?sessid=55&amp;sesskey=abc">Submit attendance</a></td><td class="pointscol">? / 2</td><td class="remarkscol"></td>`
+	if recorded {
+		open = `<td class="statuscol">Present</td><td class="pointscol">2 / 2</td><td class="remarkscol">Self-recorded</td>`
+	}
+	return `<table class="generaltable">
+<tr><td class="datecol">Mon 6 Oct 2025 08:00 - 10:00</td><td class="desccol">Week 1</td><td class="statuscol">Present</td><td class="pointscol">2 / 2</td><td class="remarkscol">Self-recorded</td></tr>
+<tr><td class="datecol">Mon 13 Oct 2025 08:00 - 10:00</td><td class="desccol">Week 2</td>` + open + `</tr>
+</table>`
+}
+
+// ctxSender records the events it delivers and, like the real senders,
+// fails once the context is done.
+type ctxSender struct {
+	mu   sync.Mutex
+	sent []notify.EventType
+}
+
+func (s *ctxSender) Send(ctx context.Context, _ string, m notify.Message) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, m.Event.Type)
+	return "1", nil
+}
+
+func (s *ctxSender) types() []notify.EventType {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]notify.EventType(nil), s.sent...)
+}
+
+func newTestRunner(t *testing.T, f *fakeMoodle) (*Runner, *ctxSender) {
+	t.Helper()
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	for k, v := range map[string]string{
+		"TIMEZONE": "UTC", "USERNAME": "jane", "PASSWORD": "secret",
+		"WA_ENDPOINT": "http://127.0.0.1:1/send", "WA_TOKEN": "t", "MOODLE_BASE_URL": srv.URL,
+		"CONFIG_FILE": "", "VAULT_FILE": "",
+	} {
+		t.Setenv(k, v)
+	}
+
+	hc, err := httpx.NewHTTP(5*time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := moodle.Sites["moodle"].Endpoints(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &ctxSender{}
+	hub := notify.NewHub()
+	hub.Register("test", out)
+	router, err := notify.NewRouter([]notify.Route{{Recipients: []notify.Recipient{{Backend: "test", To: "me"}}}}, time.UTC, hub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := notify.NewRenderer("en", "UTC", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &notify.Notifier{Hub: hub, Router: router, Messages: msgs}
+	r := &Runner{
+		Log:            zerolog.Nop(),
+		M:              &moodle.Client{HC: hc, Base: base, Loc: time.UTC, Jar: httpx.Jar(hc), Log: zerolog.Nop()},
+		CurrentPeriode: "2025",
+		Notify:         n,
+		Alerts:         &notify.Alerter{N: n},
+	}
+	return r, out
+}
+
+func TestUnrecognisedViewPagesRaiseMarkupAlert(t *testing.T) {
+	r, out := newTestRunner(t, &fakeMoodle{view: `<div class="theme-changed">nothing the parsers know</div>`})
+
+	if _, err := r.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var got []notify.EventType
+	for _, ev := range out.types() {
+		if ev == notify.EventMarkupChanged {
+			got = append(got, ev)
+		}
+	}
+	if len(got) != 1 {
+		t.Errorf("delivered %v, want one %s alert", out.types(), notify.EventMarkupChanged)
+	}
+}
+
+func TestFailedSubmitIsResentWhenItsSessionIsStillOpen(t *testing.T) {
+	f := &fakeMoodle{replies: []int{http.StatusInternalServerError}}
+	r, _ := newTestRunner(t, f)
+
+	res, err := r.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.posts != 2 || res.Submitted != 1 || res.Failed != 0 {
+		t.Errorf("posts %d, submitted %d, failed %d; want the submit resent once and confirmed", f.posts, res.Submitted, res.Failed)
+	}
+}
+
+func TestAuditConfirmsFromTheSessionRow(t *testing.T) {
+	tests := []struct {
+		name    string
+		ignore  bool
+		outcome string
+	}{
+		{name: "recorded", outcome: audit.OutcomeConfirmed},
+		// the earlier session's Self-recorded must not confirm this one
+		{name: "ignored by Moodle", ignore: true, outcome: audit.OutcomeUnconfirmed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newTestRunner(t, &fakeMoodle{ignore: tt.ignore})
+			dir := t.TempDir()
+			r.Audit = &audit.Log{Dir: dir}
+			if _, err := r.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := os.Open(filepath.Join(dir, "audit.jsonl"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			var es []audit.Entry
+			for sc := bufio.NewScanner(f); sc.Scan(); {
+				var e audit.Entry
+				if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+					t.Fatal(err)
+				}
+				es = append(es, e)
+			}
+			if len(es) != 1 || es[0].Outcome != tt.outcome || es[0].SessionID != "55" {
+				t.Fatalf("entries %+v, want one %s for session 55", es, tt.outcome)
+			}
+			if !strings.HasPrefix(es[0].SessionRow, "Mon 13 Oct 2025") {
+				t.Errorf("session row %q, want the row of session 55", es[0].SessionRow)
+			}
+		})
+	}
+}
+
+func TestRunLockIsSharedAcrossProcesses(t *testing.T) {
+	f := &fakeMoodle{}
+	r, _ := newTestRunner(t, f)
+	r.RunLockPath = filepath.Join(t.TempDir(), "run")
+
+	// another process, e.g. the daemon, is in a run
+	unlock, ok, err := filelock.TryLock(r.RunLockPath)
+	if err != nil || !ok {
+		t.Fatalf("TryLock = %v, %v", ok, err)
+	}
+	if _, err := r.Run(context.Background()); !errors.Is(err, ErrBusy) {
+		t.Errorf("Run while locked = %v, want ErrBusy", err)
+	}
+	if _, err := r.Courses(context.Background()); !errors.Is(err, ErrBusy) {
+		t.Errorf("Courses while locked = %v, want ErrBusy", err)
+	}
+	if f.posts != 0 {
+		t.Errorf("%d submits while locked", f.posts)
+	}
+
+	unlock()
+	if _, err := r.Run(context.Background()); err != nil {
+		t.Errorf("Run after unlock = %v", err)
+	}
+}
+
+func TestSkippedRunExplainsItself(t *testing.T) {
+	r, _ := newTestRunner(t, &fakeMoodle{})
+	r.Breaker = &breaker.Breaker{ProbeMin: time.Hour}
+	if _, err := r.Breaker.Failure(time.Now(), "maintenance", true); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := r.Run(context.Background())
+	if !errors.Is(err, breaker.ErrOpen) {
+		t.Fatalf("Run = %v, want breaker.ErrOpen", err)
+	}
+	if res.Started.IsZero() || res.Err == "" {
+		t.Errorf("result %+v, want a start time and the breaker in Err", res)
+	}
+}
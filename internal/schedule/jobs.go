@@ -2,10 +2,14 @@ package schedule
 
 import (
 	"context"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/robfig/cron/v3"
 	"github.com/rs/zerolog"
+
+	"github.com/emandor/gostudentubl/internal/telemetry"
 )
 
 type JobRunner interface {
@@ -15,33 +19,135 @@ type JobRunner interface {
 type Jobs struct {
 	Cron *cron.Cron
 	Log  zerolog.Logger
+	// Ctx is cancelled when the daemon shuts down, ending the job that is
+	// running so Stop does not wait out its timeout; nil means
+	// context.Background().
+	Ctx context.Context
+
+	mu          sync.Mutex
+	names       map[cron.EntryID]string
+	paused      bool
+	pausedUntil time.Time // zero means until Resume
+	running     bool
+}
+
+// NextRun is the next time a named job fires.
+type NextRun struct {
+	Job string    `json:"job"`
+	At  time.Time `json:"at"`
 }
 
 func New(tz string, logger zerolog.Logger) *Jobs {
 	loc, _ := time.LoadLocation(tz)
-	return &Jobs{Cron: cron.New(cron.WithLocation(loc)), Log: logger}
+	return &Jobs{Cron: cron.New(cron.WithLocation(loc)), Log: logger, names: map[cron.EntryID]string{}}
 }
 
 func (j *Jobs) Add(spec string, r JobRunner) error {
-	_, err := j.Cron.AddFunc(spec, func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	return j.AddFunc(spec, "attendance", r.RunAttendance)
+}
+
+// AddFunc schedules any job under a name used in its log lines.
+func (j *Jobs) AddFunc(spec, name string, fn func(ctx context.Context) error) error {
+	id, err := j.Cron.AddFunc(spec, func() {
+		if paused, until := j.Paused(); paused && name == "attendance" {
+			j.Log.Info().Str("job", name).Time("until", until).Msg("⏸️  paused, skipping")
+			return
+		}
+		base := j.Ctx
+		if base == nil {
+			base = context.Background()
+		}
+		ctx, cancel := context.WithTimeout(base, 10*time.Minute)
 		defer cancel()
+		// root span of everything the job does
+		ctx, span := telemetry.Tracer().Start(ctx, "job "+name)
+		defer span.End()
 		// TODO: fix small jitter to avoid looking botty
 		// time.Sleep(time.Duration(rand.Intn(4000)) * time.Millisecond)
-		log := j.Log.With().Str("job", "attendance").Logger()
+		log := j.Log.With().Str("job", name).Logger()
 		timeNow := time.Now().In(j.Cron.Location())
 		log = log.With().Str("time", timeNow.Format(time.RFC3339)).Logger()
-		log.Info().Msg("🚀 starting attendance job")
-		if err := r.RunAttendance(ctx); err != nil {
+		log.Info().Msgf("🚀 starting %s job", name)
+		if err := fn(ctx); err != nil {
 			failedTime := time.Now().In(j.Cron.Location())
 			log = log.With().Str("failed_time", failedTime.Format(time.RFC3339)).Logger()
 
-			log.Error().Err(err).Msg("attendance job failed")
+			log.Error().Err(err).Msgf("%s job failed", name)
+			telemetry.Fail(span, err)
 			return
 		}
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	j.names[id] = name
+	j.mu.Unlock()
+	return nil
 }
 
-func (j *Jobs) Start() { j.Cron.Start() }
-func (j *Jobs) Stop()  { ctx := j.Cron.Stop(); <-ctx.Done() }
+// Pause stops attendance jobs from running for d, or until Resume when d is 0.
+func (j *Jobs) Pause(d time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.paused = true
+	j.pausedUntil = time.Time{}
+	if d > 0 {
+		j.pausedUntil = time.Now().Add(d)
+	}
+}
+
+func (j *Jobs) Resume() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.paused = false
+	j.pausedUntil = time.Time{}
+}
+
+// Paused reports whether attendance jobs are paused and until when (zero: indefinitely).
+func (j *Jobs) Paused() (bool, time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.paused && !j.pausedUntil.IsZero() && time.Now().After(j.pausedUntil) {
+		j.paused = false
+		j.pausedUntil = time.Time{}
+	}
+	return j.paused, j.pausedUntil
+}
+
+// Next lists upcoming runs of every job, soonest first.
+func (j *Jobs) Next() []NextRun {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var out []NextRun
+	for _, e := range j.Cron.Entries() {
+		if e.Next.IsZero() {
+			continue
+		}
+		out = append(out, NextRun{Job: j.names[e.ID], At: e.Next})
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].At.Before(out[b].At) })
+	return out
+}
+
+func (j *Jobs) Start() {
+	j.Cron.Start()
+	j.mu.Lock()
+	j.running = true
+	j.mu.Unlock()
+}
+
+func (j *Jobs) Stop() {
+	j.mu.Lock()
+	j.running = false
+	j.mu.Unlock()
+	ctx := j.Cron.Stop()
+	<-ctx.Done()
+}
+
+// Running reports whether the scheduler has been started and not stopped.
+func (j *Jobs) Running() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.running
+}
@@ -0,0 +1,52 @@
+package secrets
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// CookiesKey is the vault entry holding the persisted Moodle session.
+const CookiesKey = "moodle.cookies"
+
+type cookie struct {
+	Name    string    `json:"name"`
+	Value   string    `json:"value"`
+	Path    string    `json:"path,omitempty"`
+	Domain  string    `json:"domain,omitempty"`
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+// Cookies returns the persisted session cookies, if any.
+func (v *Vault) Cookies() []*http.Cookie {
+	s, ok := v.Get(CookiesKey)
+	if !ok {
+		return nil
+	}
+	var list []cookie
+	if json.Unmarshal([]byte(s), &list) != nil {
+		return nil
+	}
+	out := make([]*http.Cookie, 0, len(list))
+	for _, c := range list {
+		out = append(out, &http.Cookie{Name: c.Name, Value: c.Value, Path: c.Path, Domain: c.Domain, Expires: c.Expires})
+	}
+	return out
+}
+
+// SaveCookies replaces the persisted session. Only that entry is written;
+// the rest of the vault is re-read from disk so secrets changed by another
+// process since Open are kept.
+func (v *Vault) SaveCookies(cs []*http.Cookie) error {
+	list := make([]cookie, 0, len(cs))
+	for _, c := range cs {
+		list = append(list, cookie{Name: c.Name, Value: c.Value, Path: c.Path, Domain: c.Domain, Expires: c.Expires})
+	}
+	b, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	return v.Update(func(data map[string]string) {
+		data[CookiesKey] = string(b)
+	})
+}
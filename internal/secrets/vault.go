@@ -0,0 +1,226 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/emandor/gostudentubl/internal/filelock"
+)
+
+// ErrPassphrase means the vault exists but could not be decrypted.
+var ErrPassphrase = errors.New("vault: wrong passphrase or corrupted file")
+
+// scrypt cost, stored in the file so it can be raised later
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// Vault is a small encrypted name/value file: AES-256-GCM with a key
+// derived by scrypt from a passphrase or the contents of a key file.
+// Every Save uses a fresh salt and nonce.
+type Vault struct {
+	path string
+	pass []byte
+
+	mu   sync.Mutex
+	data map[string]string
+}
+
+type envelope struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// Open decrypts the vault at path; a missing file is an empty vault that
+// is created on the first Save.
+func Open(path, passphrase string) (*Vault, error) {
+	if passphrase == "" {
+		return nil, errors.New("vault: empty passphrase")
+	}
+	v := &Vault{path: path, pass: []byte(passphrase)}
+	data, err := v.read()
+	if err != nil {
+		return nil, err
+	}
+	v.data = data
+	return v, nil
+}
+
+// read decrypts the file as it is on disk now.
+func (v *Vault) read() (map[string]string, error) {
+	data := map[string]string{}
+	b, err := os.ReadFile(v.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var env envelope
+	if err := json.Unmarshal(b, &env); err != nil {
+		return nil, fmt.Errorf("vault %s: %w", v.path, err)
+	}
+	if env.Version != 1 || env.KDF != "scrypt" {
+		return nil, fmt.Errorf("vault %s: unsupported version %d/%s", v.path, env.Version, env.KDF)
+	}
+	gcm, err := newGCM(v.pass, env.Salt, env.N, env.R, env.P)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, env.Nonce, env.Data, nil)
+	if err != nil {
+		return nil, ErrPassphrase
+	}
+	if err := json.Unmarshal(plain, &data); err != nil {
+		return nil, fmt.Errorf("vault %s: %w", v.path, err)
+	}
+	return data, nil
+}
+
+func newGCM(pass, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key(pass, salt, n, r, p, 32)
+	if err != nil {
+		return nil, fmt.Errorf("vault: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (v *Vault) Get(name string) (string, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.data[name]
+	return s, ok
+}
+
+// Set stores a value in memory; call Save to persist it.
+func (v *Vault) Set(name, value string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.data[name] = value
+}
+
+func (v *Vault) Delete(name string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	_, ok := v.data[name]
+	delete(v.data, name)
+	return ok
+}
+
+// Names lists the stored names, never the values.
+func (v *Vault) Names() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	names := make([]string, 0, len(v.data))
+	for n := range v.data {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Rekey switches to a new passphrase; the next Save re-encrypts with it.
+func (v *Vault) Rekey(passphrase string) error {
+	if passphrase == "" {
+		return errors.New("vault: empty passphrase")
+	}
+	v.mu.Lock()
+	v.pass = []byte(passphrase)
+	v.mu.Unlock()
+	return nil
+}
+
+// Save encrypts and atomically replaces the vault file (mode 0600) with
+// what is in memory. Use Update to change single entries without losing
+// those another process wrote since Open.
+func (v *Vault) Save() error {
+	unlock, err := filelock.Lock(v.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.write(v.data)
+}
+
+// Update re-reads the vault under a file lock, lets fn change the entries
+// and writes the result, so concurrent writers (the daemon saving its
+// session, "secret set" from a shell) never drop each other's changes.
+func (v *Vault) Update(fn func(data map[string]string)) error {
+	unlock, err := filelock.Lock(v.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	data, err := v.read()
+	if err != nil {
+		return err
+	}
+	fn(data)
+	if err := v.write(data); err != nil {
+		return err
+	}
+	v.data = data
+	return nil
+}
+
+func (v *Vault) write(data map[string]string) error {
+	plain, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	env := envelope{Version: 1, KDF: "scrypt", N: scryptN, R: scryptR, P: scryptP, Salt: make([]byte, 16)}
+	if _, err := rand.Read(env.Salt); err != nil {
+		return err
+	}
+	gcm, err := newGCM(v.pass, env.Salt, env.N, env.R, env.P)
+	if err != nil {
+		return err
+	}
+	env.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(env.Nonce); err != nil {
+		return err
+	}
+	env.Data = gcm.Seal(nil, env.Nonce, plain, nil)
+
+	b, err := json.MarshalIndent(env, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(v.path), 0o700); err != nil {
+		return err
+	}
+	tmp := v.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, v.path)
+}
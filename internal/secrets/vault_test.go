@@ -0,0 +1,83 @@
+package secrets
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestVault(t *testing.T) {
+	tests := []struct {
+		name    string
+		reopen  string // passphrase used to open the saved file
+		rekey   string // new passphrase set before Save, if any
+		wantErr error
+	}{
+		{name: "round trip", reopen: "correct horse"},
+		{name: "wrong passphrase", reopen: "battery staple", wantErr: ErrPassphrase},
+		{name: "rekey", rekey: "battery staple", reopen: "battery staple"},
+		{name: "old passphrase after rekey", rekey: "battery staple", reopen: "correct horse", wantErr: ErrPassphrase},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "vault.json")
+			v, err := Open(path, "correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			v.Set("MOODLE_PASSWORD", "hunter2")
+			if tt.rekey != "" {
+				if err := v.Rekey(tt.rekey); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := v.Save(); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Open(path, tt.reopen)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Open: got %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if s, _ := got.Get("MOODLE_PASSWORD"); s != "hunter2" {
+				t.Errorf("MOODLE_PASSWORD = %q, want %q", s, "hunter2")
+			}
+		})
+	}
+}
+
+func TestSaveCookiesKeepsOtherWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.json")
+	daemon, err := Open(path, "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a CLI process changes a secret after the daemon opened the vault
+	cli, err := Open(path, "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Update(func(data map[string]string) { data["MOODLE_PASSWORD"] = "new" }); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := daemon.SaveCookies([]*http.Cookie{{Name: "MoodleSession", Value: "abc"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Open(path, "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := got.Get("MOODLE_PASSWORD"); s != "new" {
+		t.Errorf("MOODLE_PASSWORD = %q, want the CLI's %q", s, "new")
+	}
+	if cs := got.Cookies(); len(cs) != 1 || cs[0].Value != "abc" {
+		t.Errorf("cookies = %v, want MoodleSession=abc", cs)
+	}
+}
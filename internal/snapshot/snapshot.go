@@ -0,0 +1,159 @@
+// Package snapshot keeps copies of Moodle pages the parsers could not make
+// sense of, so a markup change can be looked at after the fact.
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emandor/gostudentubl/internal/telemetry"
+)
+
+// Meta describes one snapshot; it is stored next to the page as <ID>.json.
+type Meta struct {
+	ID       string    `json:"id"`
+	At       time.Time `json:"at"`
+	Endpoint string    `json:"endpoint"` // see httpx.WithEndpoint
+	URL      string    `json:"url"`
+	Status   int       `json:"status"`
+	Reason   string    `json:"reason"`
+	RunID    string    `json:"run_id,omitempty"`
+	Size     int       `json:"size"`
+}
+
+// Store writes snapshots to Dir and prunes it to the newest Keep entries
+// no older than MaxAge. Zero Keep or MaxAge disables that limit.
+type Store struct {
+	Dir    string
+	Keep   int
+	MaxAge time.Duration
+
+	mu sync.Mutex
+}
+
+// Save redacts page and m.URL, writes both and prunes old snapshots.
+func (s *Store) Save(m Meta, page []byte) (Meta, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return m, err
+	}
+	if m.At.IsZero() {
+		m.At = time.Now()
+	}
+	page = telemetry.RedactBytes(page)
+	m.URL = string(telemetry.RedactBytes([]byte(m.URL)))
+	m.Size = len(page)
+	m.ID = s.newID(m)
+
+	meta, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return m, err
+	}
+	if err := os.WriteFile(filepath.Join(s.Dir, m.ID+".html"), page, 0o600); err != nil {
+		return m, err
+	}
+	if err := os.WriteFile(filepath.Join(s.Dir, m.ID+".json"), meta, 0o600); err != nil {
+		return m, err
+	}
+	return m, s.prune()
+}
+
+// newID sorts by time and stays unique within a second.
+func (s *Store) newID(m Meta) string {
+	base := m.At.UTC().Format("20060102T150405Z")
+	if m.Endpoint != "" {
+		base += "-" + m.Endpoint
+	}
+	id := base
+	for i := 2; ; i++ {
+		if _, err := os.Stat(filepath.Join(s.Dir, id+".json")); errors.Is(err, os.ErrNotExist) {
+			return id
+		}
+		id = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// List returns the stored snapshots, newest first.
+func (s *Store) List() ([]Meta, error) {
+	paths, err := filepath.Glob(filepath.Join(s.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var out []Meta
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		var m Meta
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(p), err)
+		}
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].At.Equal(out[j].At) {
+			return out[i].At.After(out[j].At)
+		}
+		return out[i].ID > out[j].ID
+	})
+	return out, nil
+}
+
+// Path returns the page file of the snapshot id; an empty id or "latest"
+// means the newest one. A unique prefix of an id is enough.
+func (s *Store) Path(id string) (string, Meta, error) {
+	all, err := s.List()
+	if err != nil {
+		return "", Meta{}, err
+	}
+	if len(all) == 0 {
+		return "", Meta{}, errors.New("no snapshots in " + s.Dir)
+	}
+	if id == "" || id == "latest" {
+		return filepath.Join(s.Dir, all[0].ID+".html"), all[0], nil
+	}
+	var found []Meta
+	for _, m := range all {
+		if m.ID == id {
+			found = []Meta{m}
+			break
+		}
+		if strings.HasPrefix(m.ID, id) {
+			found = append(found, m)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", Meta{}, fmt.Errorf("no snapshot %q", id)
+	case 1:
+		return filepath.Join(s.Dir, found[0].ID+".html"), found[0], nil
+	}
+	return "", Meta{}, fmt.Errorf("%q matches %d snapshots", id, len(found))
+}
+
+func (s *Store) prune() error {
+	all, err := s.List()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i, m := range all {
+		if (s.Keep > 0 && i >= s.Keep) || (s.MaxAge > 0 && time.Since(m.At) > s.MaxAge) {
+			for _, ext := range []string{".html", ".json"} {
+				if err := os.Remove(filepath.Join(s.Dir, m.ID+ext)); err != nil && !errors.Is(err, os.ErrNotExist) {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
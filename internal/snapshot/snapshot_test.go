@@ -0,0 +1,134 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2026, 10, 14, 8, 30, 0, 0, time.UTC)
+
+func save(t *testing.T, s *Store, m Meta) Meta {
+	t.Helper()
+	m, err := s.Save(m, []byte("<html><body>page</body></html>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func ids(t *testing.T, s *Store) []string {
+	t.Helper()
+	all, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, m := range all {
+		out = append(out, m.ID)
+	}
+	return out
+}
+
+func TestIDsStayUniqueWithinASecond(t *testing.T) {
+	s := &Store{Dir: t.TempDir()}
+	var got []string
+	for range 3 {
+		got = append(got, save(t, s, Meta{At: t0, Endpoint: "view"}).ID)
+	}
+	got = append(got, save(t, s, Meta{At: t0}).ID)
+	want := []string{"20261014T083000Z-view", "20261014T083000Z-view-2", "20261014T083000Z-view-3", "20261014T083000Z"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("ids %q, want %q", got, want)
+	}
+	for _, id := range want {
+		for _, ext := range []string{".html", ".json"} {
+			if _, err := os.Stat(filepath.Join(s.Dir, id+ext)); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	t.Run("keep", func(t *testing.T) {
+		s := &Store{Dir: t.TempDir(), Keep: 2}
+		for i := range 4 {
+			save(t, s, Meta{At: time.Now().Add(time.Duration(i-4) * time.Minute), Endpoint: "view"})
+		}
+		got := ids(t, s)
+		if len(got) != 2 {
+			t.Fatalf("kept %q, want the newest 2", got)
+		}
+		if files, _ := filepath.Glob(filepath.Join(s.Dir, "*")); len(files) != 4 {
+			t.Errorf("files %q, want a page and its meta for each kept snapshot", files)
+		}
+	})
+	t.Run("max age", func(t *testing.T) {
+		s := &Store{Dir: t.TempDir(), MaxAge: 24 * time.Hour}
+		save(t, s, Meta{At: time.Now().Add(-48 * time.Hour), Endpoint: "courses"})
+		fresh := save(t, s, Meta{At: time.Now().Add(-time.Hour), Endpoint: "view"})
+		if got := ids(t, s); len(got) != 1 || got[0] != fresh.ID {
+			t.Errorf("kept %q, want only %s", got, fresh.ID)
+		}
+	})
+	t.Run("no limits", func(t *testing.T) {
+		s := &Store{Dir: t.TempDir()}
+		for i := range 3 {
+			save(t, s, Meta{At: time.Now().Add(-time.Duration(i) * 400 * 24 * time.Hour)})
+		}
+		if got := ids(t, s); len(got) != 3 {
+			t.Errorf("kept %q, want all 3", got)
+		}
+	})
+}
+
+func TestPath(t *testing.T) {
+	s := &Store{Dir: t.TempDir()}
+	if _, _, err := s.Path(""); err == nil {
+		t.Error("Path in an empty store found something")
+	}
+	save(t, s, Meta{At: t0, Endpoint: "courses"})
+	save(t, s, Meta{At: t0.Add(time.Hour), Endpoint: "view"})
+	save(t, s, Meta{At: t0.Add(time.Hour), Endpoint: "view"})
+
+	tests := []struct {
+		id   string
+		want string // snapshot ID, empty when an error is expected
+	}{
+		{id: "", want: "20261014T093000Z-view-2"},
+		{id: "latest", want: "20261014T093000Z-view-2"},
+		{id: "20261014T083000Z-courses", want: "20261014T083000Z-courses"},
+		{id: "20261014T08", want: "20261014T083000Z-courses"},
+		{id: "20261014T093000Z-view", want: "20261014T093000Z-view"}, // exact wins over a longer match
+		{id: "20261014T09"}, // two matches
+		{id: "2025"},
+	}
+	for _, tt := range tests {
+		path, m, err := s.Path(tt.id)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("Path(%q) = %s, want an error", tt.id, m.ID)
+		case tt.want != "" && (err != nil || m.ID != tt.want || path != filepath.Join(s.Dir, tt.want+".html")):
+			t.Errorf("Path(%q) = %s, %s, %v; want %s", tt.id, path, m.ID, err, tt.want)
+		}
+	}
+}
+
+func TestSaveRedacts(t *testing.T) {
+	s := &Store{Dir: t.TempDir()}
+	m, err := s.Save(Meta{At: t0, URL: "https://moodle.example.ac.id/mod/attendance/attendance.php?sessid=55&sesskey=Xy9Secret"},
+		[]byte(`<input type="hidden" name="sesskey" value="Xy9Secret">`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := os.ReadFile(filepath.Join(s.Dir, m.ID+".html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(m.URL, "Xy9Secret") || strings.Contains(string(page), "Xy9Secret") {
+		t.Errorf("sesskey kept: url %q, page %q", m.URL, page)
+	}
+}
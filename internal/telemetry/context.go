@@ -0,0 +1,46 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/rs/zerolog"
+)
+
+type runIDKey struct{}
+
+// NewRunID returns a short random ID for one run.
+func NewRunID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithRunID carries id in ctx together with log tagged run_id=id, so
+// everything a run logs can be filtered out of app.log.
+func WithRunID(ctx context.Context, log zerolog.Logger, id string) context.Context {
+	ctx = context.WithValue(ctx, runIDKey{}, id)
+	return log.With().Str("run_id", id).Logger().WithContext(ctx)
+}
+
+// WithSubID tags the context logger with sub_id=<run id>.<sub> for one
+// unit of work inside a run, e.g. an attendance.
+func WithSubID(ctx context.Context, sub string) context.Context {
+	l := Ctx(ctx, zerolog.Nop()).With().Str("sub_id", RunID(ctx)+"."+sub).Logger()
+	return l.WithContext(ctx)
+}
+
+// RunID returns the ID set by WithRunID, or "".
+func RunID(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey{}).(string)
+	return id
+}
+
+// Ctx returns the logger carried by ctx, or fallback when there is none.
+func Ctx(ctx context.Context, fallback zerolog.Logger) *zerolog.Logger {
+	if l := zerolog.Ctx(ctx); l.GetLevel() != zerolog.Disabled {
+		return l
+	}
+	return &fallback
+}
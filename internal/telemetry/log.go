@@ -1,6 +1,7 @@
 package telemetry
 
 import (
+	"io"
 	"os"
 	"time"
 
@@ -8,18 +9,61 @@ import (
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-func NewLogger() zerolog.Logger {
-	// rotate app.log (~10MB, keep 3 backups)
-	rotator := &lumberjack.Logger{
-		Filename:   "app.log",
-		MaxSize:    10,
-		MaxBackups: 3,
-		MaxAge:     28,
-		Compress:   true,
+// LogOptions configures NewLogger. The zero value logs JSON at info level
+// to the console only.
+type LogOptions struct {
+	Level  string // trace, debug, info, warn or error
+	Format string // json or console
+	File   string // empty disables the file
+	// rotation of File
+	MaxSizeMB  int
+	MaxBackups int
+	MaxAgeDays int
+	Compress   bool
+	// Console enables the console writer, stdout for the daemon and stderr
+	// for one-shot commands so their output stays clean.
+	Console bool
+}
+
+func NewLogger(o LogOptions) (zerolog.Logger, error) {
+	return newLogger(o, os.Stdout)
+}
+
+// NewCLILogger logs to stderr so command output on stdout stays clean.
+func NewCLILogger(o LogOptions) (zerolog.Logger, error) {
+	return newLogger(o, os.Stderr)
+}
+
+func newLogger(o LogOptions, console io.Writer) (zerolog.Logger, error) {
+	level := zerolog.InfoLevel
+	if o.Level != "" {
+		l, err := zerolog.ParseLevel(o.Level)
+		if err != nil {
+			return zerolog.Nop(), err
+		}
+		level = l
+	}
+
+	var writers []io.Writer
+	if o.Console {
+		if o.Format == "console" {
+			console = zerolog.ConsoleWriter{Out: console, TimeFormat: time.RFC3339}
+		}
+		writers = append(writers, console)
+	}
+	if o.File != "" {
+		writers = append(writers, &lumberjack.Logger{
+			Filename:   o.File,
+			MaxSize:    o.MaxSizeMB,
+			MaxBackups: o.MaxBackups,
+			MaxAge:     o.MaxAgeDays,
+			Compress:   o.Compress,
+		})
 	}
 
-	multi := zerolog.MultiLevelWriter(os.Stdout, rotator)
-	logger := zerolog.New(multi).With().Timestamp().Logger()
+	// every event passes the redactor before it reaches a writer
+	multi := Redact(zerolog.MultiLevelWriter(writers...))
+	logger := zerolog.New(multi).Level(level).With().Timestamp().Logger()
 	zerolog.TimeFieldFormat = time.RFC3339
-	return logger
+	return logger, nil
 }
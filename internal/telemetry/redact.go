@@ -0,0 +1,68 @@
+package telemetry
+
+import (
+	"io"
+	"regexp"
+
+	"github.com/rs/zerolog"
+)
+
+const mask = "****"
+
+// secret field and parameter names, matched case-insensitively
+const secretNames = `password|passwd|sesskey|logintoken|login_token|token|secret|api_?key|authorization|cookie`
+
+var redactions = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	// JSON fields: "password":"x"
+	{regexp.MustCompile(`(?i)((?:^|[^\\])"(?:` + secretNames + `)"\s*:\s*")(?:[^"\\]|\\.)*`), "${1}" + mask},
+	// the same inside an escaped string, e.g. Moodle's M.cfg in an HTML snippet
+	{regexp.MustCompile(`(?i)(\\+"(?:` + secretNames + `)\\+"\s*:\s*\\+")[^"\\]*`), "${1}" + mask},
+	// query strings and form bodies: sesskey=abc&...
+	{regexp.MustCompile(`(?i)\b((?:` + secretNames + `)=)[^&\s"\\]+`), "${1}" + mask},
+	// hidden inputs in HTML snippets, attributes in either order:
+	// name="sesskey" value="abc", value="abc" type="hidden" name="sesskey"
+	{regexp.MustCompile(`(?i)(\bname=\\*"(?:` + secretNames + `)\\*"[^<>]*?\svalue=\\*")[^"\\]*`), "${1}" + mask},
+	{regexp.MustCompile(`(?i)(\bvalue=\\*")[^"\\]*(\\*"[^<>]*?\sname=\\*"(?:` + secretNames + `)\\*")`), "${1}" + mask + "${2}"},
+	// header values: Authorization: Bearer abc, X-Api-Key: abc
+	{regexp.MustCompile(`(?i)\b((?:authorization|x-api-key|cookie):\s*)[^"\\,]+`), "${1}" + mask},
+	{regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`), "${1} " + mask},
+	// Telegram bot tokens inside API URLs
+	{regexp.MustCompile(`/bot\d+:[A-Za-z0-9_-]+`), "/bot" + mask},
+}
+
+// redactWriter masks secrets in each serialized event before writing it.
+type redactWriter struct {
+	w zerolog.LevelWriter
+}
+
+// Redact wraps w so passwords, sesskeys, login tokens and auth headers
+// never reach it, whichever field or message they end up in.
+func Redact(w zerolog.LevelWriter) zerolog.LevelWriter {
+	return redactWriter{w: w}
+}
+
+func (r redactWriter) Write(p []byte) (int, error) {
+	return r.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (r redactWriter) WriteLevel(l zerolog.Level, p []byte) (int, error) {
+	out := RedactBytes(p)
+	if _, err := r.w.WriteLevel(l, out); err != nil {
+		return 0, err
+	}
+	// report the original length, zerolog treats a short write as an error
+	return len(p), nil
+}
+
+// RedactBytes applies the redaction rules to b.
+func RedactBytes(b []byte) []byte {
+	for _, rd := range redactions {
+		b = rd.re.ReplaceAll(b, []byte(rd.repl))
+	}
+	return b
+}
+
+var _ io.Writer = redactWriter{}
@@ -0,0 +1,42 @@
+package telemetry
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactBytes(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		secret string // must be gone
+		keep   string // must survive
+	}{
+		{name: "json field", in: `{"level":"info","password":"hunter2","user":"jane"}`, secret: "hunter2", keep: `"user":"jane"`},
+		{name: "json escaped quote", in: `{"token":"ab\"cd","x":1}`, secret: `cd`, keep: `"x":1`},
+		{name: "escaped json in a snippet", in: `{"html":"M.cfg = {\"sesskey\":\"s3ss\",\"wwwroot\":\"x\"}"}`, secret: "s3ss", keep: "wwwroot"},
+		{name: "form body", in: `{"body":"username=jane&password=hunter2&logintoken=t0k"}`, secret: "hunter2", keep: "username=jane"},
+		{name: "login token in form body", in: `username=jane&password=x&logintoken=t0k`, secret: "t0k", keep: "username=jane"},
+		{name: "query string", in: `GET /login/logout.php?sesskey=s3ss&loginpage=1`, secret: "s3ss", keep: "loginpage=1"},
+		{name: "hidden input name first", in: `<input type="hidden" name="sesskey" value="s3ss">`, secret: "s3ss", keep: `name="sesskey"`},
+		{name: "hidden input with attributes between", in: `<input name="logintoken" id="tok" type="hidden" value="t0k">`, secret: "t0k", keep: `id="tok"`},
+		{name: "hidden input value first", in: `<input type="hidden" value="s3ss" name="sesskey">`, secret: "s3ss", keep: `name="sesskey"`},
+		{name: "hidden input escaped", in: `{"html":"<input value=\"t0k\" type=\"hidden\" name=\"logintoken\">"}`, secret: "t0k", keep: "logintoken"},
+		{name: "other inputs stay", in: `<input type="hidden" value="42" name="sessid">`, keep: `value="42"`},
+		{name: "authorization header", in: `Authorization: Bearer abc.def`, secret: "abc.def", keep: "Authorization"},
+		{name: "api key header", in: `X-Api-Key: k3y`, secret: "k3y"},
+		{name: "cookie header", in: `Cookie: MoodleSession=s3ss`, secret: "s3ss"},
+		{name: "telegram bot url", in: `https://api.telegram.org/bot123:AAbbCC/sendMessage`, secret: "AAbbCC", keep: "/sendMessage"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(RedactBytes([]byte(tt.in)))
+			if tt.secret != "" && strings.Contains(got, tt.secret) {
+				t.Errorf("secret %q left in %s", tt.secret, got)
+			}
+			if tt.keep != "" && !strings.Contains(got, tt.keep) {
+				t.Errorf("%q lost from %s", tt.keep, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/emandor/gostudentubl"
+
+// TraceOptions configures SetupTracing.
+type TraceOptions struct {
+	Exporter string // none, otlp or stdout
+	Endpoint string // OTLP/HTTP collector, host:port
+	Insecure bool   // plain HTTP to the collector
+	Service  string
+	Out      io.Writer // stdout exporter target
+}
+
+// SetupTracing installs the global tracer provider. With exporter "none"
+// spans are still created but dropped, so callers never need a nil check.
+// The returned func flushes pending spans.
+func SetupTracing(ctx context.Context, o TraceOptions) (func(context.Context) error, error) {
+	var exp sdktrace.SpanExporter
+	var err error
+	switch o.Exporter {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(o.Endpoint)}
+		if o.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exp, err = otlptracehttp.New(ctx, opts...)
+	case "stdout":
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(o.Out), stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", o.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(o.Service))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return tp.Shutdown, nil
+}
+
+// Tracer is the tracer every package starts its spans from.
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Fail records err on span and marks it failed; nil is a no-op.
+func Fail(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}